@@ -8,9 +8,11 @@ import (
 	"gopkg.in/go-mixed/go-common.v1/utils"
 	"gopkg.in/go-mixed/go-common.v1/utils/core"
 	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"io"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Badger struct {
@@ -21,16 +23,28 @@ type Badger struct {
 
 	buckets sync.Map
 	options badger.Options
+
+	gcInterval     time.Duration
+	gcDiscardRatio float64
+	lastGC         GCResult
+	lastGCMu       sync.RWMutex
+	stopCh         chan struct{}
+	stopOnce       sync.Once
+	wg             sync.WaitGroup
 }
 
 type BadgerBucket struct {
 	bucket string
 	b      *Badger
 	db     *badger.DB
+
+	indexes      map[string]IndexFunc
+	indexMu      sync.RWMutex
+	indexWriteMu sync.Mutex
 }
 
-func NewBadger(path string, logger utils.ILogger, workInMemory bool) *Badger {
-	return &Badger{
+func NewBadger(path string, logger utils.ILogger, workInMemory bool, options ...BadgerOption) *Badger {
+	b := &Badger{
 		baseDir:     path,
 		logger:      logger,
 		encoderFunc: textUtils.JsonMarshalToBytes,
@@ -38,7 +52,19 @@ func NewBadger(path string, logger utils.ILogger, workInMemory bool) *Badger {
 
 		buckets: sync.Map{},
 		options: badger.DefaultOptions("").WithLogger(iLogger{logger}).WithInMemory(workInMemory),
+		stopCh:  make(chan struct{}),
 	}
+
+	for _, o := range options {
+		o(b)
+	}
+
+	if b.gcInterval > 0 && !workInMemory {
+		b.wg.Add(1)
+		go b.runGC()
+	}
+
+	return b
 }
 
 func (b *Badger) SetEncoderFunc(encoderFunc textUtils.EncoderFunc) *Badger {
@@ -60,36 +86,31 @@ func (b *Badger) DecoderFunc(buf []byte, actual any) error {
 }
 
 func (b *Badger) GC() {
-	var err error
-	b.buckets.Range(func(key, value any) bool {
-	again:
-		if err = multierr.Append(err, value.(*BadgerBucket).db.RunValueLogGC(0.7)); err == nil {
-			goto again
-		}
-
-		return true
-	})
+	b.gc(0.7)
 }
 
 func (b *Badger) Bucket(name string) *BadgerBucket {
 	bucket, ok := b.buckets.Load(name)
 	if !ok {
-		dir := filepath.Join(b.baseDir, name)
-		options := b.options
-		if !options.InMemory {
-			options = options.WithDir(dir).WithValueDir(dir)
-		}
-		db, err := badger.Open(options)
+		db, err := b.open(filepath.Join(b.baseDir, name))
 		if err != nil {
 			panic(err)
 		}
-		bucket = &BadgerBucket{bucket: name, b: b, db: db}
+		bucket = &BadgerBucket{bucket: name, b: b, db: db, indexes: map[string]IndexFunc{}}
 		b.buckets.Store(name, bucket)
 	}
 
 	return bucket.(*BadgerBucket)
 }
 
+func (b *Badger) open(dir string) (*badger.DB, error) {
+	options := b.options
+	if !options.InMemory {
+		options = options.WithDir(dir).WithValueDir(dir)
+	}
+	return badger.Open(options)
+}
+
 func (b *Badger) BucketNotCreate(name string) *BadgerBucket {
 	bucket, ok := b.buckets.Load(name)
 	if ok {
@@ -102,13 +123,18 @@ func (b *Badger) BucketNotCreate(name string) *BadgerBucket {
 func (b *Badger) DeleteBucket(name string) error {
 	var err error
 	if bucket := b.BucketNotCreate(name); bucket != nil {
-		err = bucket.db.Close()
+		err = bucket.Close()
 		b.buckets.Delete(name)
 	}
 	return err
 }
 
 func (b *Badger) Close() error {
+	b.stopOnce.Do(func() {
+		close(b.stopCh)
+	})
+	b.wg.Wait()
+
 	var err error
 	b.buckets.Range(func(key, value any) bool {
 		err = multierr.Append(err, value.(*BadgerBucket).Close())
@@ -137,17 +163,43 @@ func (b *BadgerBucket) Update(callback func(txn *badger.Txn) error) error {
 }
 
 func (b *BadgerBucket) Set(key string, val any) error {
+	return b.SetWithTTL(key, val, 0)
+}
+
+// SetWithTTL 写入kv，并在ttl之后过期，ttl<=0表示不过期
+func (b *BadgerBucket) SetWithTTL(key string, val any, ttl time.Duration) error {
 	buf, err := b.b.EncoderFunc(val)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	return b.db.Update(func(txn *badger.Txn) error {
-		return txn.Set([]byte(key), buf)
+	return b.setBytes(key, buf, ttl)
+}
+
+// setBytes 写入已编码的数据
+func (b *BadgerBucket) setBytes(key string, buf []byte, ttl time.Duration) error {
+	if err := checkKey([]byte(key)); err != nil {
+		return err
+	}
+	return b.updateIndexed(func(txn *badger.Txn, indexed bool) ([]indexChange, error) {
+		change := indexChange{key: []byte(key), newValue: buf, expiresAt: expiresAt(ttl)}
+		if indexed {
+			var err error
+			if change.oldValue, change.oldExpiresAt, err = b.getItem(txn, change.key); err != nil {
+				return nil, err
+			}
+		}
+
+		entry := badger.NewEntry(change.key, buf)
+		entry.ExpiresAt = change.expiresAt
+		return []indexChange{change}, errors.WithStack(txn.SetEntry(entry))
 	})
 }
 
 func (b *BadgerBucket) Get(key string, actual any) ([]byte, error) {
+	if err := checkKey([]byte(key)); err != nil {
+		return nil, err
+	}
 	var buf []byte
 	if err := b.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get([]byte(key))
@@ -169,11 +221,27 @@ func (b *BadgerBucket) Get(key string, actual any) ([]byte, error) {
 }
 
 func (b *BadgerBucket) Delete(key string) error {
-	return b.db.Update(func(txn *badger.Txn) error {
-		return txn.Delete([]byte(key))
+	if err := checkKey([]byte(key)); err != nil {
+		return err
+	}
+	return b.updateIndexed(func(txn *badger.Txn, indexed bool) ([]indexChange, error) {
+		change, err := b.delete(txn, []byte(key), indexed)
+		return []indexChange{change}, err
 	})
 }
 
+// delete 删除key，indexed为true时读取旧值用于删除索引
+func (b *BadgerBucket) delete(txn *badger.Txn, key []byte, indexed bool) (indexChange, error) {
+	change := indexChange{key: key}
+	if indexed {
+		var err error
+		if change.oldValue, err = b.getValue(txn, key); err != nil {
+			return change, err
+		}
+	}
+	return change, errors.WithStack(txn.Delete(key))
+}
+
 func (b *BadgerBucket) getKV(item *badger.Item) (key []byte, val []byte, err error) {
 	key = core.CopyFrom(item.Key())
 	err = item.Value(func(v []byte) error {
@@ -184,7 +252,7 @@ func (b *BadgerBucket) getKV(item *badger.Item) (key []byte, val []byte, err err
 }
 
 func (b *BadgerBucket) ForEach(callback func(txn *badger.Txn, kv *utils.KV) error) (count int64, err error) {
-	_, count, err = b.rangeCallback(b.db.View, "", "", "", -1, func(txn *badger.Txn, kv *utils.KV) error {
+	_, count, err = b.rangeCallback(b.db.View, "", "", "", -1, false, func(txn *badger.Txn, kv *utils.KV) error {
 		return callback(txn, kv)
 	})
 	return count, err
@@ -192,8 +260,21 @@ func (b *BadgerBucket) ForEach(callback func(txn *badger.Txn, kv *utils.KV) erro
 
 // DeleteRange 删除范围keyStart（含）~keyEnd（不含）
 func (b *BadgerBucket) DeleteRange(keyStart string, keyEnd string, keyPrefix string) (deletedCount int64, err error) {
-	_, deletedCount, err = b.rangeCallback(b.db.Update, keyStart, keyEnd, keyPrefix, -1, func(txn *badger.Txn, kv *utils.KV) error {
-		return txn.Delete([]byte(kv.Key))
+	err = b.updateIndexed(func(txn *badger.Txn, indexed bool) ([]indexChange, error) {
+		var changes []indexChange
+		var err error
+		view := func(callback func(txn *badger.Txn) error) error { // 在外层的事务中遍历
+			return callback(txn)
+		}
+		_, deletedCount, err = b.rangeCallback(view, keyStart, keyEnd, keyPrefix, -1, false, func(txn *badger.Txn, kv *utils.KV) error {
+			change, err := b.delete(txn, []byte(kv.Key), false)
+			if indexed {
+				change.oldValue = kv.Value
+				changes = append(changes, change)
+			}
+			return err
+		})
+		return changes, err
 	})
 	return deletedCount, err
 }
@@ -202,7 +283,20 @@ func (b *BadgerBucket) DeleteRange(keyStart string, keyEnd string, keyPrefix str
 //
 //	返回：下一个key，符合要求的kvs，错误
 func (b *BadgerBucket) Range(keyStart, keyEnd string, keyPrefix string, limit int64) (nextKey string, kvs utils.KVs, err error) {
-	nextKey, _, err = b.rangeCallback(b.db.View, keyStart, keyEnd, keyPrefix, limit, func(txn *badger.Txn, kv *utils.KV) error {
+	nextKey, _, err = b.rangeCallback(b.db.View, keyStart, keyEnd, keyPrefix, limit, false, func(txn *badger.Txn, kv *utils.KV) error {
+		kvs = append(kvs, kv)
+		return nil
+	})
+
+	return nextKey, kvs, err
+}
+
+// RevRange 【反转】返回指定范围内的所有kv，从keyStart（含）倒序到keyEnd（含），并符合前缀keyPrefix，以及数量在小于等于limit，limit为-1表示不限
+//
+//	keyStart为空表示从最后一个key开始，keyEnd为空表示遍历到第一个key
+//	返回：下一个key（即倒序的下一个，比最后一个返回的key小），符合要求的kvs，错误
+func (b *BadgerBucket) RevRange(keyStart, keyEnd string, keyPrefix string, limit int64) (nextKey string, kvs utils.KVs, err error) {
+	nextKey, _, err = b.rangeCallback(b.db.View, keyStart, keyEnd, keyPrefix, limit, true, func(txn *badger.Txn, kv *utils.KV) error {
 		kvs = append(kvs, kv)
 		return nil
 	})
@@ -213,12 +307,18 @@ func (b *BadgerBucket) Range(keyStart, keyEnd string, keyPrefix string, limit in
 // RangeCallback 按范围执行回调：从keyStart（含）循环到keyEnd（含），并且匹配前缀keyPrefix，以及数量小于等于limit
 // keyStart、keyEnd为空表示从头遍历或遍历到结尾；keyPrefix为空表示前缀不限；limit为-1表示不限制数量
 func (b *BadgerBucket) RangeCallback(keyStart string, keyEnd string, keyPrefix string, limit int64, callback func(txn *badger.Txn, kv *utils.KV) error) (nextKey string, count int64, err error) {
-	return b.rangeCallback(b.db.Update, keyStart, keyEnd, keyPrefix, limit, callback)
+	return b.rangeCallback(b.db.Update, keyStart, keyEnd, keyPrefix, limit, false, callback)
+}
+
+// RevRangeCallback 【反转】按范围执行回调：从keyStart（含）倒序循环到keyEnd（含），并且匹配前缀keyPrefix，以及数量小于等于limit
+// keyStart、keyEnd为空表示从结尾遍历或遍历到开头；keyPrefix为空表示前缀不限；limit为-1表示不限制数量
+func (b *BadgerBucket) RevRangeCallback(keyStart string, keyEnd string, keyPrefix string, limit int64, callback func(txn *badger.Txn, kv *utils.KV) error) (nextKey string, count int64, err error) {
+	return b.rangeCallback(b.db.Update, keyStart, keyEnd, keyPrefix, limit, true, callback)
 }
 
 // keyStart、keyEnd为空表示从头遍历或遍历到结尾；keyPrefix为空表示前缀不限；limit为-1表示不限制数量
-// fn为b.View、b.Update、b.Batch，callback为每一次循环的回调
-func (b *BadgerBucket) rangeCallback(fn func(func(txn *badger.Txn) error) error, keyStart string, keyEnd string, keyPrefix string, limit int64, callback func(txn *badger.Txn, kv *utils.KV) error) (nextKey string, count int64, err error) {
+// fn为b.View、b.Update、b.Batch，reverse为true时倒序遍历（此时keyStart需大于keyEnd），callback为每一次循环的回调
+func (b *BadgerBucket) rangeCallback(fn func(func(txn *badger.Txn) error) error, keyStart string, keyEnd string, keyPrefix string, limit int64, reverse bool, callback func(txn *badger.Txn, kv *utils.KV) error) (nextKey string, count int64, err error) {
 	if limit == 0 {
 		return "", 0, nil
 	}
@@ -229,13 +329,18 @@ func (b *BadgerBucket) rangeCallback(fn func(func(txn *badger.Txn) error) error,
 	var realKeyStart []byte
 	var realKeyEnd []byte
 
-	if keyStart != "" && keyEnd != "" && strings.Compare(keyStart, keyEnd) > 0 {
-		return "", 0, errors.Errorf("[Badger]range error, \"keyStart\" must less than \"keyEnd\" if they both defined")
+	if keyStart != "" && keyEnd != "" {
+		if !reverse && strings.Compare(keyStart, keyEnd) > 0 {
+			return "", 0, errors.Errorf("[Badger]range error, \"keyStart\" must less than \"keyEnd\" if they both defined")
+		} else if reverse && strings.Compare(keyStart, keyEnd) < 0 {
+			return "", 0, errors.Errorf("[Badger]reverse range error, \"keyStart\" must greater than \"keyEnd\" if they both defined")
+		}
 	}
 
 	err = fn(func(txn *badger.Txn) error {
 		options := badger.DefaultIteratorOptions
 		options.PrefetchSize = 10
+		options.Reverse = reverse // 倒序时，Seek会定位到小于等于keyStart的最大key
 		it := txn.NewIterator(options)
 		defer it.Close()
 
@@ -244,6 +349,11 @@ func (b *BadgerBucket) rangeCallback(fn func(func(txn *badger.Txn) error) error,
 		} else {
 			it.Rewind()
 		}
+		skipIndexKeys(it, reverse)
+		next := func() {
+			it.Next()
+			skipIndexKeys(it, reverse)
+		}
 		// 获取真实开始的key
 		if it.Valid() {
 			realKeyStart = core.CopyFrom(it.Item().Key())
@@ -253,7 +363,7 @@ func (b *BadgerBucket) rangeCallback(fn func(func(txn *badger.Txn) error) error,
 		var val []byte
 		var err1 error
 
-		for ; it.Valid(); it.Next() {
+		for ; it.Valid(); next() {
 			// 超过limit
 			if limit > 0 && count >= limit {
 				break
@@ -264,7 +374,9 @@ func (b *BadgerBucket) rangeCallback(fn func(func(txn *badger.Txn) error) error,
 				return errors.WithStack(err1)
 			} else if keyPrefix != "" && !bytes.HasPrefix(key, _keyPrefix) { // 前缀不符
 				continue
-			} else if keyEnd != "" && bytes.Compare(key, _keyEnd) > 0 { // 超过keyEnd
+			} else if keyEnd != "" && !reverse && bytes.Compare(key, _keyEnd) > 0 { // 超过keyEnd
+				break
+			} else if keyEnd != "" && reverse && bytes.Compare(key, _keyEnd) < 0 { // 倒序时小于keyEnd
 				break
 			}
 
@@ -301,10 +413,11 @@ func (b *BadgerBucket) Count() int64 {
 		options.PrefetchValues = false
 
 		it := txn.NewIterator(options)
-		it.Rewind()
 		defer it.Close()
-		for ; it.Valid(); it.Next() {
-
+		for it.Rewind(); it.Valid(); it.Next() {
+			if skipIndexKeys(it, false); !it.Valid() {
+				break
+			}
 			i++
 		}
 		return nil
@@ -316,3 +429,36 @@ func (b *BadgerBucket) Count() int64 {
 func (b *BadgerBucket) Clear() error {
 	return b.b.DeleteBucket(b.bucket)
 }
+
+// Backup 将版本号>=since，并且符合前缀keyPrefix的kv导出到w，keyPrefix为空表示导出整个bucket
+//
+//	返回最后一条数据的版本号，将其+1后作为下一次的since即可实现增量备份
+func (b *BadgerBucket) Backup(w io.Writer, since uint64, keyPrefix string) (uint64, error) {
+	stream := b.db.NewStream()
+	stream.LogPrefix = "[Badger]Backup " + b.bucket
+	stream.SinceTs = since
+	if keyPrefix != "" {
+		stream.Prefix = []byte(keyPrefix)
+	}
+	stream.ChooseKey = func(item *badger.Item) bool { // 不导出索引，恢复之后需要 RebuildIndex
+		return !isIndexKey(item.Key())
+	}
+
+	version, err := stream.Backup(w, since)
+	if err != nil {
+		b.b.logger.Errorf("[Badger]backup bucket \"%s\" since %d error: %s", b.bucket, since, err.Error())
+		return version, errors.WithStack(err)
+	}
+
+	b.b.logger.Debugf("[Badger]backup bucket \"%s\" with prefix \"%s\", version %d~%d", b.bucket, keyPrefix, since, version)
+	return version, nil
+}
+
+// Load 从r中恢复由 Backup 导出的数据，恢复期间不要有其它的写入事务
+func (b *BadgerBucket) Load(r io.Reader) error {
+	if err := b.db.Load(r, 256); err != nil {
+		b.b.logger.Errorf("[Badger]load bucket \"%s\" error: %s", b.bucket, err.Error())
+		return errors.WithStack(err)
+	}
+	return nil
+}
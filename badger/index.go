@@ -0,0 +1,325 @@
+package badger
+
+import (
+	"bytes"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"time"
+)
+
+// IndexFunc 从value（编码后的数据）中提取出索引值，一个value可以有多个索引值，返回空表示不需要索引
+type IndexFunc func(value []byte) []string
+
+// 索引和数据保存在同一个DB中，key的前缀为 indexKeyPrefix，并且和数据在同一个事务中写入，所以索引和数据始终一致
+//
+//	索引的key为：indexKeyPrefix + 索引名 + \x00 + 索引值 + \x00 + 主键，value为主键
+//	以 indexKeyPrefix 开头的key是保留的，不能写入，Range、Count、ForEach、Backup 等也会跳过这些key
+var indexKeyPrefix = []byte("__index__\x00")
+
+var indexSeparator = []byte{0}
+
+func indexNamePrefix(name string) []byte {
+	return append(append(append([]byte{}, indexKeyPrefix...), name...), indexSeparator...)
+}
+
+func indexKey(name string, indexValue string, key []byte) []byte {
+	return append(append([]byte{}, indexKeyPrefix...), bytes.Join([][]byte{[]byte(name), []byte(indexValue), key}, indexSeparator)...)
+}
+
+func isIndexKey(key []byte) bool {
+	return bytes.HasPrefix(key, indexKeyPrefix)
+}
+
+// checkKey 以 indexKeyPrefix 开头的key保留给索引使用
+func checkKey(key []byte) error {
+	if isIndexKey(key) {
+		return errors.Errorf("[Badger]key \"%s\" is reserved for index", key)
+	}
+	return nil
+}
+
+// skipIndexKeys 迭代器位于索引的key上时跳过所有的索引：正序时定位到索引之后的第一个key，倒序时定位到索引之前的最后一个key
+func skipIndexKeys(it *badger.Iterator, reverse bool) {
+	if !it.Valid() || !isIndexKey(it.Item().Key()) {
+		return
+	}
+	if reverse { // indexKeyPrefix本身不是索引的key，倒序Seek会定位到比其小的最大key
+		it.Seek(indexKeyPrefix)
+		return
+	}
+	end := append([]byte{}, indexKeyPrefix...)
+	end[len(end)-1]++
+	it.Seek(end)
+}
+
+// RegisterIndex 注册名为name的索引，之后通过 Set、SetWithTTL、Delete、DeleteRange 的写入会在同一个事务中维护索引
+//
+//	注意：注册之前已经存在的数据不会被索引，需要调用 RebuildIndex；通过 Update、RangeCallback 等直接操作 badger.Txn 的写入也不会维护索引
+func (b *BadgerBucket) RegisterIndex(name string, fn IndexFunc) *BadgerBucket {
+	b.indexMu.Lock()
+	defer b.indexMu.Unlock()
+
+	b.indexes[name] = fn
+	return b
+}
+
+// indexFuncs 返回已注册索引的副本，避免遍历时和 RegisterIndex 并发读写
+func (b *BadgerBucket) indexFuncs() map[string]IndexFunc {
+	b.indexMu.RLock()
+	defer b.indexMu.RUnlock()
+
+	indexes := make(map[string]IndexFunc, len(b.indexes))
+	for name, fn := range b.indexes {
+		indexes[name] = fn
+	}
+	return indexes
+}
+
+func (b *BadgerBucket) indexFunc(name string) (IndexFunc, error) {
+	b.indexMu.RLock()
+	defer b.indexMu.RUnlock()
+	if fn, ok := b.indexes[name]; ok {
+		return fn, nil
+	}
+	return nil, errors.Errorf("[Badger]index \"%s\" of bucket \"%s\" is not registered", name, b.bucket)
+}
+
+// getItem 读取key当前的值以及过期时间，不存在返回nil
+func (b *BadgerBucket) getItem(txn *badger.Txn, key []byte) ([]byte, uint64, error) {
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	val, err := item.ValueCopy(nil)
+	return val, item.ExpiresAt(), errors.WithStack(err)
+}
+
+func (b *BadgerBucket) getValue(txn *badger.Txn, key []byte) ([]byte, error) {
+	val, _, err := b.getItem(txn, key)
+	return val, err
+}
+
+// indexChange 一个key的索引变化
+type indexChange struct {
+	key                []byte
+	oldValue, newValue []byte
+	// oldExpiresAt、expiresAt 数据在写入之前、之后的过期时间（Unix秒），0表示不过期
+	oldExpiresAt, expiresAt uint64
+}
+
+// writeIndexes 在数据的事务txn中按照新旧值的差异修改索引。过期时间变化时（包括从有ttl改为不过期）会重写所有的索引，使其和数据同时过期
+func (b *BadgerBucket) writeIndexes(txn *badger.Txn, indexes map[string]IndexFunc, changes ...indexChange) error {
+	for _, c := range changes {
+		for name, fn := range indexes {
+			var oldIndexValues, newIndexValues []string
+			if c.oldValue != nil {
+				oldIndexValues = fn(c.oldValue)
+			}
+			if c.newValue != nil {
+				newIndexValues = fn(c.newValue)
+			}
+
+			removed, added := diffIndexValues(oldIndexValues, newIndexValues)
+			if c.newValue != nil && c.oldValue != nil && c.oldExpiresAt != c.expiresAt {
+				added = newIndexValues
+			}
+			for _, v := range removed {
+				if err := txn.Delete(indexKey(name, v, c.key)); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			for _, v := range added {
+				entry := badger.NewEntry(indexKey(name, v, c.key), c.key)
+				entry.ExpiresAt = c.expiresAt
+				if err := txn.SetEntry(entry); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// updateIndexed 在修改数据的事务fn中，由fn返回所有key的变化，并在同一个事务中维护索引；没有注册索引时直接执行fn
+func (b *BadgerBucket) updateIndexed(fn func(txn *badger.Txn, indexed bool) ([]indexChange, error)) error {
+	indexes := b.indexFuncs()
+	if len(indexes) == 0 {
+		return b.db.Update(func(txn *badger.Txn) error {
+			_, err := fn(txn, false)
+			return err
+		})
+	}
+
+	// 串行修改，避免并发写入同一个key时事务冲突（badger.ErrConflict）
+	b.indexWriteMu.Lock()
+	defer b.indexWriteMu.Unlock()
+
+	return b.db.Update(func(txn *badger.Txn) error {
+		changes, err := fn(txn, true)
+		if err != nil {
+			return err
+		}
+		return b.writeIndexes(txn, indexes, changes...)
+	})
+}
+
+// RebuildIndex 清空并重新建立名为name的索引，用于注册索引前已有数据、从 Backup 中恢复了数据，或者索引和数据不一致的情况
+//
+//	注意：重建期间不要有其它的写入
+func (b *BadgerBucket) RebuildIndex(name string) error {
+	fn, err := b.indexFunc(name)
+	if err != nil {
+		return err
+	}
+
+	if err = b.db.DropPrefix(indexNamePrefix(name)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// 数据量可能超过单个事务的限制，所以使用WriteBatch
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	var count int64
+	err = b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if skipIndexKeys(it, false); !it.Valid() {
+				break
+			}
+			item := it.Item()
+			key := item.KeyCopy(nil)
+			val, err := item.ValueCopy(nil)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			for _, v := range fn(val) {
+				entry := badger.NewEntry(indexKey(name, v, key), key)
+				entry.ExpiresAt = item.ExpiresAt()
+				if err = wb.SetEntry(entry); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			count++
+		}
+		return nil
+	})
+	if err == nil {
+		err = errors.WithStack(wb.Flush())
+	}
+
+	if err != nil {
+		b.b.logger.Errorf("[Badger]rebuild index \"%s\" of bucket \"%s\" error: %s", name, b.bucket, err.Error())
+		return err
+	}
+	b.b.logger.Infof("[Badger]rebuild index \"%s\" of bucket \"%s\" with %d items", name, b.bucket, count)
+	return nil
+}
+
+// FindByIndex 返回索引name中值为indexValue的所有kv，并尝试将数据导出到actual，如果无需导出，actual传入nil
+//
+//	注意：actual必须是slice
+func (b *BadgerBucket) FindByIndex(name string, indexValue string, actual any) (utils.KVs, error) {
+	_, kvs, err := b.RangeByIndex(name, indexValue, "", -1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kvs) > 0 && !core.IsNil(actual) {
+		if err = textUtils.ListDecodeAny(b.b.DecoderFunc, kvs.Values(), actual); err != nil {
+			b.b.logger.Errorf("[Badger]FindByIndex data and decode error: %s", err.Error())
+			return nil, errors.WithStack(err)
+		}
+	}
+	return kvs, nil
+}
+
+// RangeByIndex 返回索引name中值为indexValue的kv，按主键排序，从主键keyStart（含）开始，数量小于等于limit，limit为-1表示不限
+//
+//	keyStart为空表示从头开始；返回：下一页的keyStart（为空表示没有下一页），符合要求的kvs，错误
+func (b *BadgerBucket) RangeByIndex(name string, indexValue string, keyStart string, limit int64) (nextKey string, kvs utils.KVs, err error) {
+	fn, err := b.indexFunc(name)
+	if err != nil {
+		return "", nil, err
+	} else if limit == 0 {
+		return "", nil, nil
+	}
+
+	err = b.db.View(func(txn *badger.Txn) error {
+		options := badger.DefaultIteratorOptions
+		options.Prefix = indexKey(name, indexValue, nil)
+		it := txn.NewIterator(options)
+		defer it.Close()
+
+		var count int64
+		for it.Seek(indexKey(name, indexValue, []byte(keyStart))); it.Valid(); it.Next() {
+			pk, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			val, err := b.getValue(txn, pk)
+			if err != nil {
+				return err
+			} else if val == nil || !containsIndexValue(fn(val), indexValue) { // 索引和数据不一致时跳过
+				continue
+			}
+			if limit > 0 && count >= limit {
+				nextKey = string(pk)
+				break
+			}
+			kvs = kvs.Append(string(pk), val)
+			count++
+		}
+		return nil
+	})
+
+	return nextKey, kvs, err
+}
+
+func containsIndexValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// diffIndexValues 返回在oldValues中但不在newValues中的值（需要删除），以及在newValues中但不在oldValues中的值（需要新增）
+func diffIndexValues(oldValues, newValues []string) (removed []string, added []string) {
+	oldSet := make(map[string]struct{}, len(oldValues))
+	for _, v := range oldValues {
+		oldSet[v] = struct{}{}
+	}
+	newSet := make(map[string]struct{}, len(newValues))
+	for _, v := range newValues {
+		newSet[v] = struct{}{}
+	}
+
+	for v := range oldSet {
+		if _, ok := newSet[v]; !ok {
+			removed = append(removed, v)
+		}
+	}
+	for v := range newSet {
+		if _, ok := oldSet[v]; !ok {
+			added = append(added, v)
+		}
+	}
+	return removed, added
+}
+
+// expiresAt 和 badger.Entry.WithTTL 的计算方式相同
+func expiresAt(ttl time.Duration) uint64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return uint64(time.Now().Add(ttl).Unix())
+}
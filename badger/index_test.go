@@ -0,0 +1,139 @@
+package badger
+
+import (
+	"bytes"
+	"github.com/dgraph-io/badger/v3"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	Name  string
+	Email string
+}
+
+func emailIndex(value []byte) []string {
+	var user testUser
+	if err := textUtils.JsonUnmarshalFromBytes(value, &user); err != nil {
+		return nil
+	}
+	return []string{user.Email}
+}
+
+func TestIndex(t *testing.T) {
+	b := NewBadger(t.TempDir(), utils.NewDefaultLogger(), false)
+	defer b.Close()
+
+	bucket := b.Bucket("users").RegisterIndex("email", emailIndex)
+	// 0xff开头的key不会和索引冲突
+	for key, user := range map[string]testUser{"a": {"a", "a@a.com"}, "b": {"b", "a@a.com"}, "\xff": {"c", "c@a.com"}} {
+		if err := bucket.Set(key, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var users []testUser
+	if kvs, err := bucket.FindByIndex("email", "a@a.com", &users); err != nil {
+		t.Fatal(err)
+	} else if len(kvs) != 2 || kvs[0].Key != "a" || users[1].Name != "b" {
+		t.Errorf("find by index: %v", kvs)
+	}
+	if nextKey, kvs, _ := bucket.RangeByIndex("email", "a@a.com", "", 1); nextKey != "b" || len(kvs) != 1 {
+		t.Errorf("range by index: %s %v", nextKey, kvs)
+	}
+	if kvs, _ := bucket.FindByIndex("email", "c@a.com", nil); len(kvs) != 1 || kvs[0].Key != "\xff" {
+		t.Errorf("binary key: %v", kvs)
+	}
+	// 索引和数据在同一个DB中，遍历时跳过索引的key
+	if c := bucket.Count(); c != 3 {
+		t.Errorf("count: %d", c)
+	}
+	if _, kvs, _ := bucket.Range("", "", "", -1); len(kvs) != 3 {
+		t.Errorf("range: %v", kvs)
+	}
+	if _, kvs, _ := bucket.RevRange("", "", "", -1); len(kvs) != 3 || kvs[0].Key != "\xff" {
+		t.Errorf("reverse range: %v", kvs)
+	}
+	buf := &bytes.Buffer{}
+	if _, err := bucket.Backup(buf, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	restored := b.Bucket("restored")
+	if err := restored.Load(buf); err != nil {
+		t.Fatal(err)
+	}
+	_ = restored.View(func(txn *badger.Txn) error { // 备份中不包括索引
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		var n int
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		if n != 3 {
+			t.Errorf("backup keys: %d", n)
+		}
+		return nil
+	})
+	if err := bucket.Set(string(indexKey("email", "a@a.com", []byte("a"))), testUser{}); err == nil {
+		t.Errorf("reserved key should return error")
+	}
+
+	// 修改、删除之后旧的索引被删除
+	if err := bucket.Set("a", testUser{"a", "b@a.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if kvs, _ := bucket.FindByIndex("email", "a@a.com", nil); len(kvs) != 0 {
+		t.Errorf("stale index: %v", kvs)
+	}
+	if _, err := bucket.DeleteRange("\xff", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if kvs, _ := bucket.FindByIndex("email", "c@a.com", nil); len(kvs) != 0 {
+		t.Errorf("delete range: %v", kvs)
+	}
+
+	// 从有ttl改为不过期时，未变化的索引也不再过期
+	if err := bucket.SetWithTTL("a", testUser{"a", "b@a.com"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt := indexExpiresAt(t, bucket, "email", "b@a.com", "a"); expiresAt == 0 {
+		t.Errorf("index should expire with data")
+	}
+	if err := bucket.Set("a", testUser{"a", "b@a.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if expiresAt := indexExpiresAt(t, bucket, "email", "b@a.com", "a"); expiresAt != 0 {
+		t.Errorf("index expires at %d after ttl removed", expiresAt)
+	}
+
+	if err := bucket.RebuildIndex("email"); err != nil {
+		t.Fatal(err)
+	}
+	if kvs, _ := bucket.FindByIndex("email", "b@a.com", nil); len(kvs) != 1 {
+		t.Errorf("rebuild: %v", kvs)
+	}
+	if _, err := bucket.FindByIndex("name", "a", nil); err == nil {
+		t.Errorf("unregistered index should return error")
+	}
+}
+
+func indexExpiresAt(t *testing.T, bucket *BadgerBucket, name, indexValue, key string) uint64 {
+	var expiresAt uint64
+	err := bucket.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(indexKey(name, indexValue, []byte(key)))
+		if err != nil {
+			return err
+		}
+		expiresAt = item.ExpiresAt()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expiresAt
+}
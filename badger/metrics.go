@@ -0,0 +1,76 @@
+package badger
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/go-mixed/go-common.v1/metrics.v1"
+)
+
+type statsCollector struct {
+	b *Badger
+
+	lsmSize        *prometheus.Desc
+	vlogSize       *prometheus.Desc
+	keyCount       *prometheus.Desc
+	lastGCAt       *prometheus.Desc
+	lastGCDuration *prometheus.Desc
+	lastGCRewrites *prometheus.Desc
+	lastGCError    *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*statsCollector)(nil)
+
+// RegisterMetrics 将 Stats 注册为Prometheus的仪表盘指标，每次采集时读取最新的Stats
+func (b *Badger) RegisterMetrics(reg *metrics.Registry) {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(reg.RegistryOptions.Namespace, reg.RegistryOptions.Subsystem, name),
+			help,
+			labels,
+			reg.RegistryOptions.ConstLabels,
+		)
+	}
+
+	reg.Register(&statsCollector{
+		b: b,
+
+		lsmSize:        desc("badger_lsm_size_bytes", "Size of the LSM tree of a badger bucket", "bucket"),
+		vlogSize:       desc("badger_vlog_size_bytes", "Size of the value-log of a badger bucket", "bucket"),
+		keyCount:       desc("badger_keys", "Estimated number of keys in a badger bucket", "bucket"),
+		lastGCAt:       desc("badger_last_gc_timestamp_seconds", "Unix time of the last value-log GC"),
+		lastGCDuration: desc("badger_last_gc_duration_seconds", "Duration of the last value-log GC"),
+		lastGCRewrites: desc("badger_last_gc_rewrites", "Number of value-log files rewritten by the last GC"),
+		lastGCError:    desc("badger_last_gc_error", "Whether the last value-log GC failed (1) or not (0)"),
+	})
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.lsmSize
+	ch <- c.vlogSize
+	ch <- c.keyCount
+	ch <- c.lastGCAt
+	ch <- c.lastGCDuration
+	ch <- c.lastGCRewrites
+	ch <- c.lastGCError
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.b.Stats()
+	for bucket, s := range stats.Buckets {
+		ch <- prometheus.MustNewConstMetric(c.lsmSize, prometheus.GaugeValue, float64(s.LsmSize), bucket)
+		ch <- prometheus.MustNewConstMetric(c.vlogSize, prometheus.GaugeValue, float64(s.VlogSize), bucket)
+		ch <- prometheus.MustNewConstMetric(c.keyCount, prometheus.GaugeValue, float64(s.KeyCount), bucket)
+	}
+
+	var at float64
+	if !stats.LastGC.At.IsZero() {
+		at = float64(stats.LastGC.At.UnixMilli()) / 1000
+	}
+	var failed float64
+	if stats.LastGC.Err != nil {
+		failed = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.lastGCAt, prometheus.GaugeValue, at)
+	ch <- prometheus.MustNewConstMetric(c.lastGCDuration, prometheus.GaugeValue, stats.LastGC.Duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.lastGCRewrites, prometheus.GaugeValue, float64(stats.LastGC.Rewrites))
+	ch <- prometheus.MustNewConstMetric(c.lastGCError, prometheus.GaugeValue, failed)
+}
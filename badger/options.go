@@ -0,0 +1,16 @@
+package badger
+
+import "time"
+
+type BadgerOption func(*Badger)
+
+// WithGC 定时对所有bucket执行value-log GC，interval为执行间隔，discardRatio为value-log文件可丢弃数据的比例（0~1）
+//
+//	当一次GC没有回收任何文件时，下次执行的间隔会翻倍（最多为interval的8倍），回收成功后恢复为interval
+//	注意：内存模式下不会执行GC
+func WithGC(interval time.Duration, discardRatio float64) BadgerOption {
+	return func(b *Badger) {
+		b.gcInterval = interval
+		b.gcDiscardRatio = discardRatio
+	}
+}
@@ -0,0 +1,125 @@
+package badger
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"time"
+)
+
+// GCResult 一次value-log GC的结果
+type GCResult struct {
+	// At GC开始的时间，零值表示还未执行过GC
+	At       time.Time
+	Duration time.Duration
+	// Rewrites 所有bucket中被重写（回收）的value-log文件数
+	Rewrites int
+	// Err 除了 badger.ErrNoRewrite 之外的错误
+	Err error
+}
+
+type BadgerBucketStats struct {
+	LsmSize  int64
+	VlogSize int64
+	// KeyCount 由SST表的key数量估算，包含旧版本、已删除的key，不包含还在memtable中的key。精确的数量见 BadgerBucket.Count
+	KeyCount int64
+}
+
+type BadgerStats struct {
+	Buckets map[string]BadgerBucketStats
+	LastGC  GCResult
+}
+
+func (b *Badger) runGC() {
+	defer b.wg.Done()
+
+	interval := b.gcInterval
+	maxInterval := b.gcInterval * 8
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	b.logger.Infof("[Badger]start value-log GC every %s, discard ratio: %.2f", b.gcInterval, b.gcDiscardRatio)
+	for {
+		select {
+		case <-b.stopCh:
+			b.logger.Infof("[Badger]stop value-log GC")
+			return
+		case <-timer.C:
+		}
+
+		result := b.gc(b.gcDiscardRatio)
+		if result.Err != nil {
+			b.logger.Errorf("[Badger]value-log GC error: %s", result.Err.Error())
+		}
+
+		// 没有回收任何文件时退避，回收成功后恢复间隔
+		if result.Rewrites > 0 {
+			interval = b.gcInterval
+		} else if interval < maxInterval {
+			interval *= 2
+			if interval > maxInterval {
+				interval = maxInterval
+			}
+		}
+		timer.Reset(interval)
+	}
+}
+
+// gc 对所有bucket执行value-log GC，直到无可回收的文件为止
+func (b *Badger) gc(discardRatio float64) GCResult {
+	result := GCResult{At: time.Now()}
+	b.buckets.Range(func(key, value any) bool {
+		for {
+			err := value.(*BadgerBucket).db.RunValueLogGC(discardRatio)
+			if err == nil {
+				result.Rewrites++
+				continue
+			} else if !errors.Is(err, badger.ErrNoRewrite) {
+				result.Err = multierr.Append(result.Err, errors.WithMessagef(err, "bucket \"%s\"", key))
+			}
+			break
+		}
+		return true
+	})
+	result.Duration = time.Since(result.At)
+
+	b.lastGCMu.Lock()
+	b.lastGC = result
+	b.lastGCMu.Unlock()
+
+	b.logger.Debugf("[Badger]value-log GC rewrote %d files in %0.6f", result.Rewrites, result.Duration.Seconds())
+	return result
+}
+
+// LastGC 最后一次GC的结果
+func (b *Badger) LastGC() GCResult {
+	b.lastGCMu.RLock()
+	defer b.lastGCMu.RUnlock()
+	return b.lastGC
+}
+
+// Stats 返回所有已打开bucket的LSM/value-log大小、估算的key数量，以及最后一次GC的结果
+func (b *Badger) Stats() BadgerStats {
+	stats := BadgerStats{
+		Buckets: map[string]BadgerBucketStats{},
+		LastGC:  b.LastGC(),
+	}
+	b.buckets.Range(func(key, value any) bool {
+		stats.Buckets[key.(string)] = value.(*BadgerBucket).Stats()
+		return true
+	})
+	return stats
+}
+
+func (b *BadgerBucket) Stats() BadgerBucketStats {
+	lsm, vlog := b.db.Size()
+	stats := BadgerBucketStats{
+		LsmSize:  lsm,
+		VlogSize: vlog,
+	}
+	// 不遍历key，Prometheus每次采集都会调用
+	for _, table := range b.db.Tables() {
+		stats.KeyCount += int64(table.KeyCount)
+	}
+	return stats
+}
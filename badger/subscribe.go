@@ -0,0 +1,72 @@
+package badger
+
+import (
+	"context"
+	"github.com/dgraph-io/badger/v3"
+	"github.com/dgraph-io/badger/v3/pb"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+)
+
+type BadgerEventType int8
+
+const (
+	BadgerPut BadgerEventType = iota + 1
+	BadgerDelete
+)
+
+func (e BadgerEventType) String() string {
+	switch e {
+	case BadgerPut:
+		return "put"
+	case BadgerDelete:
+		return "delete"
+	}
+	return ""
+}
+
+// BadgerHandle 处理写入事件，kv为写入之后的kv（删除时Value为nil）
+//
+//	badger的原生订阅不提供写入之前的值，所以prevKv始终为nil
+type BadgerHandle interface {
+	Handle(eventType BadgerEventType, prevKv *utils.KV, kv *utils.KV)
+}
+
+type BadgerHandleFn func(eventType BadgerEventType, prevKv *utils.KV, kv *utils.KV)
+
+func (fn BadgerHandleFn) Handle(eventType BadgerEventType, prevKv *utils.KV, kv *utils.KV) {
+	fn(eventType, prevKv, kv)
+}
+
+// Subscribe 订阅本bucket中前缀为keyPrefix的写入事件，keyPrefix为空表示订阅所有key，返回的cancel用于取消订阅
+//
+//	使用badger的原生订阅，事件在事务提交之后在独立的协程中依次回调；bucket关闭时订阅自动结束
+//	注意：
+//	1. 订阅是在协程中异步注册的，返回之后立即写入的数据可能收不到事件
+//	2. badger不区分空值和删除，所以Value为空的写入都视为删除
+func (b *BadgerBucket) Subscribe(keyPrefix string, handle BadgerHandle) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		err := b.db.Subscribe(ctx, func(list *badger.KVList) error {
+			for _, item := range list.GetKv() {
+				if isIndexKey(item.GetKey()) {
+					continue
+				}
+				kv := utils.NewKV(string(item.GetKey()), nil)
+				eventType := BadgerDelete
+				if len(item.GetValue()) > 0 {
+					eventType = BadgerPut
+					kv.Value = core.CopyFrom(item.GetValue())
+				}
+				handle.Handle(eventType, nil, kv)
+			}
+			return nil
+		}, []pb.Match{{Prefix: []byte(keyPrefix)}})
+		if err != nil && ctx.Err() == nil {
+			b.b.logger.Errorf("[Badger]subscribe bucket \"%s\" error: %s", b.bucket, err.Error())
+		}
+	}()
+
+	return cancel
+}
@@ -0,0 +1,41 @@
+package badger
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/cache.v1"
+	"time"
+)
+
+type badgerTierStore struct {
+	b *BadgerBucket
+}
+
+// TierStore 作为 cache.TieredCache 的一级存储（比如边缘节点的本地磁盘缓存），读写的都是原始数据，不经过EncoderFunc/DecoderFunc
+func (b *BadgerBucket) TierStore() cache.ITierStore {
+	return badgerTierStore{b: b}
+}
+
+func (s badgerTierStore) GetBytes(key string) ([]byte, error) {
+	var buf []byte
+	err := s.b.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		buf, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return buf, errors.WithStack(err)
+}
+
+func (s badgerTierStore) SetBytes(key string, buf []byte, ttl time.Duration) error {
+	return s.b.setBytes(key, buf, ttl)
+}
+
+func (s badgerTierStore) Del(key string) error {
+	return s.b.Delete(key)
+}
@@ -0,0 +1,75 @@
+package boltdb
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WriteTo 在只读事务中将整个数据库的一致性副本写入w，备份期间不会阻塞其它读写事务
+func (b *Bolt) WriteTo(w io.Writer) (n int64, err error) {
+	err = b.DB.View(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+		return errors.WithStack(err)
+	})
+	return n, err
+}
+
+// BackupToFile 将整个数据库的一致性副本写入到path文件中
+func (b *Bolt) BackupToFile(path string) error {
+	now := time.Now()
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		return errors.WithStack(tx.CopyFile(path, 0o664))
+	})
+	if err != nil {
+		b.logger.Errorf("[Bolt]backup to \"%s\" error: %s", path, err.Error())
+		return err
+	}
+
+	b.logger.Infof("[Bolt]backup to \"%s\", %0.6f", path, time.Since(now).Seconds())
+	return nil
+}
+
+// BackupHandler 返回一个将数据库副本作为附件下载的 http.HandlerFunc，filename为下载的文件名
+//
+//	在gin中可以使用 gin.WrapF(b.BackupHandler("data.db"))
+func (b *Bolt) BackupHandler(filename string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := b.DB.View(func(tx *bolt.Tx) error {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+			w.Header().Set("Content-Length", strconv.FormatInt(tx.Size(), 10))
+			_, err := tx.WriteTo(w)
+			return err
+		})
+		if err != nil {
+			b.logger.Errorf("[Bolt]backup to http response error: %s", err.Error())
+			// 响应头和部分数据已经发送，无法再返回错误，中断连接让客户端发现下载不完整
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// CompactTo 将数据库压缩到一个新的文件path中（path不能是已有的数据库），txMaxSize为每个写事务的最大字节数，0表示不限制
+//
+//	bolt删除数据后不会缩小文件，压缩可以回收这部分空间
+func (b *Bolt) CompactTo(path string, txMaxSize int64) error {
+	now := time.Now()
+	dst, err := bolt.Open(path, 0o664, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return errors.Errorf("open bolt file \"%s\" error: %s", path, err.Error())
+	}
+	defer dst.Close()
+
+	if err = bolt.Compact(dst, b.DB, txMaxSize); err != nil {
+		b.logger.Errorf("[Bolt]compact to \"%s\" error: %s", path, err.Error())
+		return errors.WithStack(err)
+	}
+
+	b.logger.Infof("[Bolt]compact to \"%s\", %0.6f", path, time.Since(now).Seconds())
+	return nil
+}
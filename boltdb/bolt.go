@@ -2,12 +2,14 @@ package boltdb
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/pkg/errors"
 	bolt "go.etcd.io/bbolt"
 	"gopkg.in/go-mixed/go-common.v1/utils"
 	"gopkg.in/go-mixed/go-common.v1/utils/core"
 	"gopkg.in/go-mixed/go-common.v1/utils/text"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,17 +19,28 @@ type Bolt struct {
 	logger      utils.ILogger
 	decoderFunc textUtils.DecoderFunc
 	encoderFunc textUtils.EncoderFunc
+
+	// bucket路径 => 索引名 => IndexFunc
+	indexes map[string]map[string]IndexFunc
+	indexMu sync.RWMutex
+
+	subscriptions  map[uint64]*subscription
+	subscriptionID uint64
+	subscriptionMu sync.RWMutex
 }
 
 type BoltBucket struct {
 	*Bolt
+	// bucket 用于日志的名称，嵌套的bucket为使用 "/" 连接的路径
 	bucket []byte
+	// 嵌套bucket的每一级名称
+	path [][]byte
 }
 
 func NewBolt(path string, logger utils.ILogger) (*Bolt, error) {
 	db, err := bolt.Open(path, 0o664, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
-		return nil, errors.Errorf("open bolt file \"%s\" error: %w", path, err)
+		return nil, errors.WithMessagef(err, "open bolt file \"%s\"", path)
 	}
 
 	return &Bolt{
@@ -36,6 +49,9 @@ func NewBolt(path string, logger utils.ILogger) (*Bolt, error) {
 
 		encoderFunc: textUtils.JsonMarshalToBytes,
 		decoderFunc: textUtils.JsonUnmarshalFromBytes,
+
+		indexes:       map[string]map[string]IndexFunc{},
+		subscriptions: map[uint64]*subscription{},
 	}, nil
 }
 
@@ -57,11 +73,54 @@ func (b *Bolt) DecoderFunc(buf []byte, actual any) error {
 	return b.decoderFunc(buf, actual)
 }
 
+// Bucket 得到顶层的bucket，名称中的 "/" 没有特殊含义，嵌套的bucket见 NestedBucket
 func (b *Bolt) Bucket(bucket string) *BoltBucket {
-	return &BoltBucket{
+	return b.NestedBucket(bucket)
+}
+
+// NestedBucket 得到嵌套的bucket，path为每一级的名称，比如 NestedBucket("tenant", "a", "users") 表示 tenant 下的 a 下的 users
+func (b *Bolt) NestedBucket(path ...string) *BoltBucket {
+	bucket := &BoltBucket{
 		Bolt:   b,
-		bucket: []byte(bucket),
+		bucket: []byte(strings.Join(path, "/")),
+	}
+	for _, name := range path {
+		bucket.path = append(bucket.path, []byte(name))
 	}
+	return bucket
+}
+
+// ListBuckets 列出parent下的bucket，返回每个bucket完整的路径，parent为空表示列出顶层的bucket
+//
+//	recursive为true时会递归列出所有层级的bucket
+func (b *Bolt) ListBuckets(recursive bool, parent ...string) ([][]string, error) {
+	var res [][]string
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		if len(parent) == 0 {
+			return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+				if string(name) != indexBucketName {
+					res = appendBucketNames(res, []string{string(name)}, bucket, recursive)
+				}
+				return nil
+			})
+		}
+
+		if bucket := lookupBucket(tx, b.NestedBucket(parent...).path); bucket != nil {
+			res = appendChildBucketNames(res, parent, bucket, recursive)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// DeleteBucket 删除bucket（以及嵌套在其中的所有bucket），bucket不存在时不报错，path为每一级的名称
+func (b *Bolt) DeleteBucket(path ...string) error {
+	return b.NestedBucket(path...).Clear()
+}
+
+// BucketStats 返回bucket的统计信息，包括key数量、B+树深度、page的使用情况，bucket不存在时返回零值，path为每一级的名称
+func (b *Bolt) BucketStats(path ...string) (bolt.BucketStats, error) {
+	return b.NestedBucket(path...).Stats()
 }
 
 func (b *Bolt) Close() error {
@@ -71,7 +130,7 @@ func (b *Bolt) Close() error {
 // Batch 批量操作（事务），注意：使用Batch的写入操作会有延迟（MaxBatchDelay），其它事务会出现幻读
 func (b *BoltBucket) Batch(callback func(*bolt.Bucket) error) error {
 	return b.DB.Batch(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists(b.bucket)
+		bucket, err := createBucket(tx, b.path)
 		if err != nil {
 			b.logger.Errorf("bolt bucket %s error: %s", b.bucket, err.Error())
 			return errors.WithStack(err)
@@ -84,7 +143,7 @@ func (b *BoltBucket) Batch(callback func(*bolt.Bucket) error) error {
 // View 只读操作
 func (b *BoltBucket) View(callback func(*bolt.Bucket) error) error {
 	return b.DB.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(b.bucket)
+		bucket := lookupBucket(tx, b.path)
 		if bucket == nil {
 			return nil
 		}
@@ -95,7 +154,7 @@ func (b *BoltBucket) View(callback func(*bolt.Bucket) error) error {
 // Update 修改操作，注意：和 Batch 不同的是，Update中写入操作是实时的
 func (b *BoltBucket) Update(callback func(*bolt.Bucket) error) error {
 	return b.DB.Update(func(tx *bolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists(b.bucket)
+		bucket, err := createBucket(tx, b.path)
 		if err != nil {
 			b.logger.Errorf("[Bolt]bucket %s error: %s", b.bucket, err.Error())
 			return err
@@ -179,6 +238,12 @@ func (b *BoltBucket) Set(key string, value any) error {
 		if err != nil {
 			return errors.WithMessagef(err, "[Bolt]Set data and encode error")
 		}
+		oldValue := bucket.Get([]byte(key))
+		if err = b.updateIndexes(bucket, []byte(key), oldValue, buf); err != nil {
+			b.logger.Errorf("[Bolt]Set index error: %s", err.Error())
+			return err
+		}
+		b.notify(bucket, []byte(key), oldValue, buf)
 		if err = bucket.Put([]byte(key), buf); err != nil {
 			b.logger.Errorf("[Bolt]Set error: %s", err.Error())
 		}
@@ -188,9 +253,9 @@ func (b *BoltBucket) Set(key string, value any) error {
 
 func (b *BoltBucket) Delete(key string) error {
 	return b.Update(func(bucket *bolt.Bucket) error {
-		err := bucket.Delete([]byte(key))
+		err := b.delete(bucket, []byte(key), bucket.Get([]byte(key)))
 		if err != nil {
-			b.logger.Errorf("[Bolt]Set error: %s", err.Error())
+			b.logger.Errorf("[Bolt]Delete error: %s", err.Error())
 		}
 		return errors.WithStack(err)
 	})
@@ -202,7 +267,7 @@ func (b *BoltBucket) Delete(key string) error {
 //	注意：由于使用的是Batch，所以删除有延时，其它事务会出现幻读
 func (b *BoltBucket) BatchDeleteRange(keyStart string, keyEnd string, keyPrefix string) (deletedCount int64, err error) {
 	_, deletedCount, err = b.rangeCallback(b.Batch, keyStart, keyEnd, keyPrefix, -1, func(bucket *bolt.Bucket, kv *utils.KV) error {
-		err1 := bucket.Delete([]byte(kv.Key))
+		err1 := b.delete(bucket, []byte(kv.Key), kv.Value)
 		if err1 != nil {
 			b.logger.Errorf("[Bolt]deleting \"%s\" of bucket: \"%s\" error: %s", kv.Key, b.bucket, err1.Error())
 		}
@@ -216,7 +281,7 @@ func (b *BoltBucket) BatchDeleteRange(keyStart string, keyEnd string, keyPrefix
 //	keyStart为空表示bucket第一个，keyEnd为空表示直到bucket最后一个，keyPrefix为空表示不筛选前缀
 func (b *BoltBucket) DeleteRange(keyStart string, keyEnd string, keyPrefix string) (deletedCount int64, err error) {
 	_, deletedCount, err = b.rangeCallback(b.Update, keyStart, keyEnd, keyPrefix, -1, func(bucket *bolt.Bucket, kv *utils.KV) error {
-		err1 := bucket.Delete([]byte(kv.Key))
+		err1 := b.delete(bucket, []byte(kv.Key), kv.Value)
 		if err1 != nil {
 			b.logger.Errorf("[Bolt]deleting \"%s\" of bucket: \"%s\" error: %s", kv.Key, b.bucket, err1.Error())
 		}
@@ -225,34 +290,54 @@ func (b *BoltBucket) DeleteRange(keyStart string, keyEnd string, keyPrefix strin
 	return deletedCount, err
 }
 
+// Count 返回bucket中key的数量，不包括嵌套的bucket以及其中的key
 func (b *BoltBucket) Count() int {
 	var count int
-	if b.bucket != nil {
-		if err := b.DB.View(func(tx *bolt.Tx) error {
-			if bucket := tx.Bucket(b.bucket); bucket != nil {
-				stats := bucket.Stats()
-				count = stats.KeyN
+	if err := b.View(func(bucket *bolt.Bucket) error {
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			if v != nil { // value为nil的是嵌套的bucket
+				count++
 			}
-			return nil
-		}); err != nil {
-			b.logger.Errorf("[Bolt]read bucket \"%s\" count error: %s", b.bucket, err.Error())
 		}
+		return nil
+	}); err != nil {
+		b.logger.Errorf("[Bolt]read bucket \"%s\" count error: %s", b.bucket, err.Error())
 	}
 	return count
 }
 
 func (b *BoltBucket) Clear() error {
-	if b.bucket != nil {
+	if len(b.path) > 0 {
 		return b.DB.Update(func(tx *bolt.Tx) error {
-			if bucket := tx.Bucket(b.bucket); bucket != nil {
-				return tx.DeleteBucket(b.bucket)
+			if err := deleteIndexRoots(tx, b.path); err != nil {
+				return err
 			}
-			return nil
+			return deleteBucket(tx, b.path)
 		})
 	}
 	return nil
 }
 
+// Stats 返回bucket的统计信息，包括key数量（包含嵌套的bucket中的key）、B+树深度、page的使用情况，bucket不存在时返回零值
+func (b *BoltBucket) Stats() (bolt.BucketStats, error) {
+	var stats bolt.BucketStats
+	err := b.View(func(bucket *bolt.Bucket) error {
+		stats = bucket.Stats()
+		return nil
+	})
+	return stats, err
+}
+
+// Buckets 列出嵌套在本bucket下的bucket，返回每个bucket完整的路径
+func (b *BoltBucket) Buckets(recursive bool) ([][]string, error) {
+	parent := make([]string, 0, len(b.path))
+	for _, name := range b.path {
+		parent = append(parent, string(name))
+	}
+	return b.ListBuckets(recursive, parent...)
+}
+
 // FindLte 查找 等于key 或 小于key的上一项 Less than and equal
 // 注意: 返回的key可能和需要查找key并不相似
 // 返回 key value 错误
@@ -470,3 +555,70 @@ func (b *BoltBucket) rangeCallback(fn func(callback func(*bolt.Bucket) error) er
 
 	return nextKey, count, err
 }
+
+// pathKey 将bucket的路径编码为唯一的字符串，比如 Bucket("a/b") 和 NestedBucket("a", "b") 是不同的
+func pathKey(path [][]byte) string {
+	return fmt.Sprintf("%q", path)
+}
+
+// lookupBucket 按照路径逐级查找bucket，任意一级不存在则返回nil
+func lookupBucket(tx *bolt.Tx, path [][]byte) *bolt.Bucket {
+	if len(path) == 0 {
+		return nil
+	}
+	bucket := tx.Bucket(path[0])
+	for i := 1; i < len(path) && bucket != nil; i++ {
+		bucket = bucket.Bucket(path[i])
+	}
+	return bucket
+}
+
+// createBucket 按照路径逐级创建bucket
+func createBucket(tx *bolt.Tx, path [][]byte) (*bolt.Bucket, error) {
+	if len(path) == 0 {
+		return nil, bolt.ErrBucketNameRequired
+	}
+	bucket, err := tx.CreateBucketIfNotExists(path[0])
+	for i := 1; i < len(path) && err == nil; i++ {
+		bucket, err = bucket.CreateBucketIfNotExists(path[i])
+	}
+	return bucket, err
+}
+
+// deleteBucket 删除路径中最后一级的bucket，不存在时不报错
+func deleteBucket(tx *bolt.Tx, path [][]byte) error {
+	if len(path) == 0 {
+		return bolt.ErrBucketNameRequired
+	} else if len(path) == 1 {
+		if tx.Bucket(path[0]) == nil {
+			return nil
+		}
+		return tx.DeleteBucket(path[0])
+	}
+
+	parent := lookupBucket(tx, path[:len(path)-1])
+	if parent == nil || parent.Bucket(path[len(path)-1]) == nil {
+		return nil
+	}
+	return parent.DeleteBucket(path[len(path)-1])
+}
+
+func appendBucketNames(res [][]string, path []string, bucket *bolt.Bucket, recursive bool) [][]string {
+	res = append(res, path)
+	if recursive {
+		res = appendChildBucketNames(res, path, bucket, recursive)
+	}
+	return res
+}
+
+// appendChildBucketNames bucket中value为nil的key即是嵌套的bucket
+func appendChildBucketNames(res [][]string, parent []string, bucket *bolt.Bucket, recursive bool) [][]string {
+	cursor := bucket.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		if v == nil {
+			path := append(append(make([]string, 0, len(parent)+1), parent...), string(k))
+			res = appendBucketNames(res, path, bucket.Bucket(k), recursive)
+		}
+	}
+	return res
+}
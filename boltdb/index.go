@@ -0,0 +1,291 @@
+package boltdb
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+)
+
+// IndexFunc 从value（编码后的数据）中提取出索引值，一个value可以有多个索引值，返回空表示不需要索引
+//
+//	比如按email索引用户：
+//	func(buf []byte) []string {
+//		var user User
+//		if err := textUtils.JsonUnmarshalFromBytes(buf, &user); err != nil {
+//			return nil
+//		}
+//		return []string{user.Email}
+//	}
+type IndexFunc func(value []byte) []string
+
+// 所有的索引都保存在此顶层bucket下：__index__/编码后的bucket路径（见 pathKey）/索引名，
+// 所以 __index__ 不能作为顶层bucket的名称，ListBuckets 也不会列出
+const indexBucketName = "__index__"
+
+// 索引的key为：索引值 + \x00 + 主键，value为主键
+var indexSeparator = []byte{0}
+
+// RegisterIndex 注册名为name的索引，之后通过 Set、Delete、DeleteRange、BatchDeleteRange 的写入会在同一个事务中维护索引
+//
+//	注意：注册之前已经存在的数据不会被索引，需要调用 RebuildIndex；通过 Update、Batch、ForEach 等直接操作 bolt.Bucket 的写入也不会维护索引
+func (b *BoltBucket) RegisterIndex(name string, fn IndexFunc) *BoltBucket {
+	b.indexMu.Lock()
+	defer b.indexMu.Unlock()
+
+	path := pathKey(b.path)
+	if _, ok := b.indexes[path]; !ok {
+		b.indexes[path] = map[string]IndexFunc{}
+	}
+	b.indexes[path][name] = fn
+	return b
+}
+
+// indexFuncs 返回已注册索引的副本，避免遍历时和 RegisterIndex 并发读写
+func (b *BoltBucket) indexFuncs() map[string]IndexFunc {
+	b.indexMu.RLock()
+	defer b.indexMu.RUnlock()
+
+	indexes := make(map[string]IndexFunc, len(b.indexes[pathKey(b.path)]))
+	for name, fn := range b.indexes[pathKey(b.path)] {
+		indexes[name] = fn
+	}
+	return indexes
+}
+
+func (b *BoltBucket) indexFunc(name string) (IndexFunc, error) {
+	b.indexMu.RLock()
+	defer b.indexMu.RUnlock()
+	if fn, ok := b.indexes[pathKey(b.path)][name]; ok {
+		return fn, nil
+	}
+	return nil, errors.Errorf("[Bolt]index \"%s\" of bucket \"%s\" is not registered", name, b.bucket)
+}
+
+func (b *BoltBucket) indexRootPath() [][]byte {
+	if len(b.path) == 0 {
+		return nil
+	}
+	return [][]byte{[]byte(indexBucketName), []byte(pathKey(b.path))}
+}
+
+func (b *BoltBucket) indexPath(name string) [][]byte {
+	return append(b.indexRootPath(), []byte(name))
+}
+
+func indexKey(indexValue string, key []byte) []byte {
+	return bytes.Join([][]byte{[]byte(indexValue), key}, indexSeparator)
+}
+
+// updateIndexes 按照旧值oldValue和新值newValue的差异来修改索引，oldValue为nil表示新增，newValue为nil表示删除
+//
+//	必须在写入（或删除）数据之前调用，因为oldValue可能引用了bucket内部的内存
+func (b *BoltBucket) updateIndexes(bucket *bolt.Bucket, key []byte, oldValue, newValue []byte) error {
+	for name, fn := range b.indexFuncs() {
+		var oldIndexValues, newIndexValues []string
+		if oldValue != nil {
+			oldIndexValues = fn(oldValue)
+		}
+		if newValue != nil {
+			newIndexValues = fn(newValue)
+		}
+
+		removed, added := diffIndexValues(oldIndexValues, newIndexValues)
+		if len(removed) == 0 && len(added) == 0 {
+			continue
+		}
+
+		index, err := createBucket(bucket.Tx(), b.indexPath(name))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, v := range removed {
+			if err = index.Delete(indexKey(v, key)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		for _, v := range added {
+			if err = index.Put(indexKey(v, key), key); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+// delete 删除key，并删除其索引
+func (b *BoltBucket) delete(bucket *bolt.Bucket, key []byte, oldValue []byte) error {
+	if err := b.updateIndexes(bucket, key, oldValue, nil); err != nil {
+		return err
+	}
+	b.notify(bucket, key, oldValue, nil)
+	return bucket.Delete(key)
+}
+
+// RebuildIndex 清空并重新建立名为name的索引，用于注册索引前已有数据，或者索引和数据不一致的情况
+func (b *BoltBucket) RebuildIndex(name string) error {
+	fn, err := b.indexFunc(name)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	err = b.DB.Update(func(tx *bolt.Tx) error {
+		if err := deleteBucket(tx, b.indexPath(name)); err != nil {
+			return errors.WithStack(err)
+		}
+		bucket := lookupBucket(tx, b.path)
+		if bucket == nil {
+			return nil
+		}
+		index, err := createBucket(tx, b.indexPath(name))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			if v == nil { // 嵌套的bucket
+				return nil
+			}
+			for _, indexValue := range fn(v) {
+				if err := index.Put(indexKey(indexValue, k), k); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			count++
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("[Bolt]rebuild index \"%s\" of bucket \"%s\" error: %s", name, b.bucket, err.Error())
+		return err
+	}
+	b.logger.Infof("[Bolt]rebuild index \"%s\" of bucket \"%s\" with %d items", name, b.bucket, count)
+	return nil
+}
+
+// FindByIndex 返回索引name中值为indexValue的所有kv，并尝试将数据导出到actual，如果无需导出，actual传入nil
+//
+//	注意：actual必须是slice
+func (b *BoltBucket) FindByIndex(name string, indexValue string, actual any) (utils.KVs, error) {
+	_, kvs, err := b.RangeByIndex(name, indexValue, "", -1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kvs) > 0 && !core.IsNil(actual) {
+		if err = textUtils.ListDecodeAny(b.DecoderFunc, kvs.Values(), actual); err != nil {
+			b.logger.Errorf("[Bolt]FindByIndex data and decode error: %s", err.Error())
+			return nil, errors.WithStack(err)
+		}
+	}
+	return kvs, nil
+}
+
+// RangeByIndex 返回索引name中值为indexValue的kv，按主键排序，从主键keyStart（含）开始，数量小于等于limit，limit为-1表示不限
+//
+//	keyStart为空表示从头开始；返回：下一页的keyStart（为空表示没有下一页），符合要求的kvs，错误
+func (b *BoltBucket) RangeByIndex(name string, indexValue string, keyStart string, limit int64) (nextKey string, kvs utils.KVs, err error) {
+	fn, err := b.indexFunc(name)
+	if err != nil {
+		return "", nil, err
+	} else if limit == 0 {
+		return "", nil, nil
+	}
+
+	err = b.DB.View(func(tx *bolt.Tx) error {
+		bucket := lookupBucket(tx, b.path)
+		index := lookupBucket(tx, b.indexPath(name))
+		if bucket == nil || index == nil {
+			return nil
+		}
+
+		prefix := indexKey(indexValue, nil)
+		cursor := index.Cursor()
+		var count int64
+		for k, pk := cursor.Seek(indexKey(indexValue, []byte(keyStart))); k != nil && bytes.HasPrefix(k, prefix); k, pk = cursor.Next() {
+			if limit > 0 && count >= limit {
+				nextKey = string(pk)
+				break
+			}
+
+			v := bucket.Get(pk)
+			if v == nil || !containsIndexValue(fn(v), indexValue) { // 索引和数据不一致时跳过
+				continue
+			}
+			kvs = kvs.Append(string(pk), core.CopyFrom(v)) // GC 后v会被清空，必须Copy
+			count++
+		}
+		return nil
+	})
+
+	return nextKey, kvs, err
+}
+
+// containsIndexValue values中是否包含value
+func containsIndexValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteIndexRoots 删除bucket以及嵌套在其中的所有bucket的索引，必须在删除bucket之前调用
+func deleteIndexRoots(tx *bolt.Tx, path [][]byte) error {
+	if len(path) == 0 {
+		return nil
+	}
+	index := tx.Bucket([]byte(indexBucketName))
+	if index == nil {
+		return nil
+	}
+	if index.Bucket([]byte(pathKey(path))) != nil {
+		if err := index.DeleteBucket([]byte(pathKey(path))); err != nil {
+			return err
+		}
+	}
+
+	bucket := lookupBucket(tx, path)
+	if bucket == nil {
+		return nil
+	}
+	cursor := bucket.Cursor()
+	for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+		if v == nil { // 嵌套的bucket
+			child := append(append(make([][]byte, 0, len(path)+1), path...), k)
+			if err := deleteIndexRoots(tx, child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diffIndexValues 返回在oldValues中但不在newValues中的值（需要删除），以及在newValues中但不在oldValues中的值（需要新增）
+func diffIndexValues(oldValues, newValues []string) (removed []string, added []string) {
+	oldSet := make(map[string]struct{}, len(oldValues))
+	for _, v := range oldValues {
+		oldSet[v] = struct{}{}
+	}
+	newSet := make(map[string]struct{}, len(newValues))
+	for _, v := range newValues {
+		newSet[v] = struct{}{}
+	}
+
+	for v := range oldSet {
+		if _, ok := newSet[v]; !ok {
+			removed = append(removed, v)
+		}
+	}
+	for v := range newSet {
+		if _, ok := oldSet[v]; !ok {
+			added = append(added, v)
+		}
+	}
+	return removed, added
+}
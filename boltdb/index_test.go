@@ -0,0 +1,109 @@
+package boltdb
+
+import (
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"testing"
+)
+
+type testUser struct {
+	Name  string
+	Email string
+}
+
+func emailIndex(value []byte) []string {
+	var user testUser
+	if err := textUtils.JsonUnmarshalFromBytes(value, &user); err != nil {
+		return nil
+	}
+	return []string{user.Email}
+}
+
+func TestIndex(t *testing.T) {
+	b, err := NewBolt(t.TempDir()+"/test.db", utils.NewDefaultLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// "a/b" 和嵌套的 a -> b 是不同的bucket，索引也互不影响
+	flat := b.Bucket("a/b").RegisterIndex("email", emailIndex)
+	nested := b.NestedBucket("a", "b").RegisterIndex("email", emailIndex)
+	for key, user := range map[string]testUser{"1": {"a", "a@a.com"}, "2": {"b", "a@a.com"}} {
+		if err = flat.Set(key, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = nested.Set("3", testUser{"c", "a@a.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var users []testUser
+	if kvs, err := flat.FindByIndex("email", "a@a.com", &users); err != nil {
+		t.Fatal(err)
+	} else if len(kvs) != 2 || kvs[0].Key != "1" || users[1].Name != "b" {
+		t.Errorf("find by index: %v", kvs)
+	}
+	if kvs, _ := nested.FindByIndex("email", "a@a.com", nil); len(kvs) != 1 || kvs[0].Key != "3" {
+		t.Errorf("nested find by index: %v", kvs)
+	}
+	if nextKey, kvs, _ := flat.RangeByIndex("email", "a@a.com", "", 1); nextKey != "2" || len(kvs) != 1 {
+		t.Errorf("range by index: %s %v", nextKey, kvs)
+	}
+
+	// 修改、删除之后旧的索引被删除
+	if err = flat.Set("1", testUser{"a", "b@a.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = flat.Delete("2"); err != nil {
+		t.Fatal(err)
+	}
+	if kvs, _ := flat.FindByIndex("email", "a@a.com", nil); len(kvs) != 0 {
+		t.Errorf("stale index: %v", kvs)
+	}
+	if kvs, _ := flat.FindByIndex("email", "b@a.com", nil); len(kvs) != 1 {
+		t.Errorf("updated index: %v", kvs)
+	}
+
+	if err = flat.RebuildIndex("email"); err != nil {
+		t.Fatal(err)
+	}
+	if kvs, _ := flat.FindByIndex("email", "b@a.com", nil); len(kvs) != 1 {
+		t.Errorf("rebuild: %v", kvs)
+	}
+	if _, err = flat.FindByIndex("name", "a", nil); err == nil {
+		t.Errorf("unregistered index should return error")
+	}
+
+	// 索引的bucket不会被列出，Count不包括嵌套的bucket
+	buckets, err := b.ListBuckets(true)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(buckets) != 3 {
+		t.Errorf("list buckets: %v", buckets)
+	}
+	if c := b.NestedBucket("a").Count(); c != 0 {
+		t.Errorf("count: %d", c)
+	}
+
+	// 删除父bucket时嵌套bucket的索引也被删除
+	if err = b.DeleteBucket("a"); err != nil {
+		t.Fatal(err)
+	}
+	_ = b.DB.View(func(tx *bolt.Tx) error {
+		if lookupBucket(tx, nested.indexRootPath()) != nil {
+			t.Errorf("index of nested bucket is not deleted")
+		}
+		return nil
+	})
+	if err = nested.Set("3", testUser{"c", "c@a.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if kvs, _ := nested.FindByIndex("email", "a@a.com", nil); len(kvs) != 0 {
+		t.Errorf("index after delete bucket: %v", kvs)
+	}
+	if kvs, _ := nested.FindByIndex("email", "c@a.com", nil); len(kvs) != 1 {
+		t.Errorf("index after delete bucket: %v", kvs)
+	}
+}
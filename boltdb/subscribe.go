@@ -0,0 +1,112 @@
+package boltdb
+
+import (
+	"bytes"
+	"context"
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+)
+
+type BoltEventType int8
+
+const (
+	BoltPut BoltEventType = iota + 1
+	BoltDelete
+)
+
+func (e BoltEventType) String() string {
+	switch e {
+	case BoltPut:
+		return "put"
+	case BoltDelete:
+		return "delete"
+	}
+	return ""
+}
+
+// BoltHandle 处理写入事件，prevKv为写入之前的kv（新增时为nil），kv为写入之后的kv（删除时Value为nil）
+type BoltHandle interface {
+	Handle(eventType BoltEventType, prevKv *utils.KV, kv *utils.KV)
+}
+
+type BoltHandleFn func(eventType BoltEventType, prevKv *utils.KV, kv *utils.KV)
+
+func (fn BoltHandleFn) Handle(eventType BoltEventType, prevKv *utils.KV, kv *utils.KV) {
+	fn(eventType, prevKv, kv)
+}
+
+type subscription struct {
+	bucket    string
+	keyPrefix []byte
+	handle    BoltHandle
+}
+
+// Subscribe 订阅本bucket中前缀为keyPrefix的写入事件，keyPrefix为空表示订阅所有key，返回的cancel用于取消订阅
+//
+//	事件会在事务提交成功之后，在写入的协程中依次回调，所以handle中不要有耗时的操作；事务回滚时不会产生事件
+//	注意：只有通过 Set、Delete、DeleteRange、BatchDeleteRange 的写入才会产生事件，直接操作 bolt.Bucket 的写入不会
+func (b *BoltBucket) Subscribe(keyPrefix string, handle BoltHandle) context.CancelFunc {
+	b.subscriptionMu.Lock()
+	defer b.subscriptionMu.Unlock()
+
+	b.subscriptionID++
+	id := b.subscriptionID
+	b.subscriptions[id] = &subscription{
+		bucket:    pathKey(b.path),
+		keyPrefix: []byte(keyPrefix),
+		handle:    handle,
+	}
+
+	return func() {
+		b.subscriptionMu.Lock()
+		defer b.subscriptionMu.Unlock()
+		delete(b.subscriptions, id)
+	}
+}
+
+func (b *BoltBucket) subscribersOf(key []byte) []BoltHandle {
+	b.subscriptionMu.RLock()
+	defer b.subscriptionMu.RUnlock()
+
+	var handles []BoltHandle
+	path := pathKey(b.path)
+	for _, s := range b.subscriptions {
+		if s.bucket == path && bytes.HasPrefix(key, s.keyPrefix) {
+			handles = append(handles, s.handle)
+		}
+	}
+	return handles
+}
+
+// notify 在事务提交后通知订阅者，newValue为nil表示删除
+//
+//	必须在写入（或删除）数据之前调用，因为oldValue可能引用了bucket内部的内存
+func (b *BoltBucket) notify(bucket *bolt.Bucket, key []byte, oldValue, newValue []byte) {
+	if newValue == nil && oldValue == nil { // 删除不存在的key
+		return
+	}
+	handles := b.subscribersOf(key)
+	if len(handles) == 0 {
+		return
+	}
+
+	eventType := BoltPut
+	if newValue == nil {
+		eventType = BoltDelete
+	}
+	var prevKv *utils.KV
+	if oldValue != nil {
+		prevKv = utils.NewKV(string(key), core.CopyFrom(oldValue)) // 事务结束后oldValue会失效，必须Copy
+	}
+	kv := utils.NewKV(string(key), nil)
+	if newValue != nil {
+		kv.Value = core.CopyFrom(newValue)
+	}
+
+	bucket.Tx().OnCommit(func() {
+		for _, handle := range handles {
+			handle.Handle(eventType, prevKv, kv)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+	"strconv"
+)
+
+// IFilter 布隆过滤器：Test返回false表示一定不存在，返回true表示可能存在
+type IFilter interface {
+	Add(key string) error
+	Test(key string) (bool, error)
+	// Clear 清空过滤器
+	Clear() error
+}
+
+// BloomFilter 固定容量的布隆过滤器，数据超过capacity之后误判率会迅速上升，此时应使用 ScalableBloomFilter
+type BloomFilter struct {
+	store IBitStore
+	name  string
+	m     uint64 // 位数
+	k     uint64 // hash函数的数量
+}
+
+var _ IFilter = (*BloomFilter)(nil)
+
+// NewBloomFilter 根据预计的数据量capacity和误判率fpRate计算位数和hash函数的数量，数据保存在store的name中
+func NewBloomFilter(store IBitStore, name string, capacity uint64, fpRate float64) *BloomFilter {
+	m, k := estimateParameters(capacity, fpRate)
+	return &BloomFilter{
+		store: store,
+		name:  name,
+		m:     m,
+		k:     k,
+	}
+}
+
+// estimateParameters m = -n*ln(p)/(ln2)^2，k = m/n*ln2
+func estimateParameters(n uint64, p float64) (m uint64, k uint64) {
+	if n == 0 {
+		n = 1
+	}
+	m = uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k = uint64(math.Ceil(math.Ln2 * float64(m) / float64(n)))
+	return max(m, 1), max(k, 1)
+}
+
+func max(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// offsets 使用双重hash（h1 + i*h2）得到k个位的偏移量
+func (f *BloomFilter) offsets(key string) []uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32
+
+	offsets := make([]uint64, f.k)
+	for i := uint64(0); i < f.k; i++ {
+		offsets[i] = (h1 + i*h2) % f.m
+	}
+	return offsets
+}
+
+func (f *BloomFilter) Add(key string) error {
+	return f.store.SetBits(f.name, f.offsets(key))
+}
+
+func (f *BloomFilter) Test(key string) (bool, error) {
+	return f.store.TestBits(f.name, f.offsets(key))
+}
+
+func (f *BloomFilter) Clear() error {
+	return f.store.Del(f.name)
+}
+
+// ScalableBloomFilter 可扩容的布隆过滤器：当前层的数据量达到容量时新增一层，
+// 新层的容量为上一层的2倍、误判率为上一层的0.8倍，使总体的误判率收敛于 fpRate/(1-0.8)
+//
+//	层数、每层的数据量也保存在store中，所以多个进程可以共享同一个（Redis中的）过滤器
+type ScalableBloomFilter struct {
+	store    IBitStore
+	name     string
+	capacity uint64
+	fpRate   float64
+}
+
+var _ IFilter = (*ScalableBloomFilter)(nil)
+
+const (
+	scalableGrowth     = 2
+	scalableTightening = 0.8
+)
+
+// NewScalableBloomFilter capacity、fpRate为第一层的容量和误判率
+func NewScalableBloomFilter(store IBitStore, name string, capacity uint64, fpRate float64) *ScalableBloomFilter {
+	return &ScalableBloomFilter{
+		store:    store,
+		name:     name,
+		capacity: max(capacity, 1),
+		fpRate:   fpRate,
+	}
+}
+
+func (f *ScalableBloomFilter) layersKey() string {
+	return f.name + ":layers"
+}
+
+func (f *ScalableBloomFilter) countKey(layer int64) string {
+	return f.name + ":count:" + strconv.FormatInt(layer, 10)
+}
+
+func (f *ScalableBloomFilter) layerCapacity(layer int64) uint64 {
+	return f.capacity * uint64(math.Pow(scalableGrowth, float64(layer)))
+}
+
+func (f *ScalableBloomFilter) layer(layer int64) *BloomFilter {
+	return NewBloomFilter(f.store, f.name+":"+strconv.FormatInt(layer, 10), f.layerCapacity(layer),
+		f.fpRate*math.Pow(scalableTightening, float64(layer)))
+}
+
+// layers 返回当前的层数，至少为1
+func (f *ScalableBloomFilter) layers() (int64, error) {
+	n, err := f.store.Counter(f.layersKey())
+	if err != nil {
+		return 0, err
+	}
+	return n + 1, nil
+}
+
+func (f *ScalableBloomFilter) Add(key string) error {
+	layers, err := f.layers()
+	if err != nil {
+		return err
+	}
+	for i := int64(0); i < layers; i++ {
+		if ok, err := f.layer(i).Test(key); err != nil {
+			return err
+		} else if ok { // 已存在，不重复计数
+			return nil
+		}
+	}
+
+	current := layers - 1
+	if err = f.layer(current).Add(key); err != nil {
+		return err
+	}
+	count, err := f.store.Incr(f.countKey(current))
+	if err != nil {
+		return err
+	}
+	if uint64(count) == f.layerCapacity(current) { // 只有恰好达到容量的那一次写入才扩容，避免并发时多次扩容
+		_, err = f.store.Incr(f.layersKey())
+	}
+	return err
+}
+
+func (f *ScalableBloomFilter) Test(key string) (bool, error) {
+	layers, err := f.layers()
+	if err != nil {
+		return false, err
+	}
+	// 从新到旧测试，新写入的数据都在最新的一层
+	for i := layers - 1; i >= 0; i-- {
+		if ok, err := f.layer(i).Test(key); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (f *ScalableBloomFilter) Clear() error {
+	layers, err := f.layers()
+	if err != nil {
+		return err
+	}
+	keys := []string{f.layersKey()}
+	for i := int64(0); i < layers; i++ {
+		keys = append(keys, f.name+":"+strconv.FormatInt(i, 10), f.countKey(i))
+	}
+	return f.store.Del(keys...)
+}
@@ -0,0 +1,32 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestScalableBloomFilter(t *testing.T) {
+	f := NewScalableBloomFilter(NewMemoryBitStore(), "test", 100, 0.01)
+	for i := 0; i < 1000; i++ {
+		if err := f.Add("key-" + strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		if ok, _ := f.Test("key-" + strconv.Itoa(i)); !ok {
+			t.Fatalf("key-%d should exist", i)
+		}
+	}
+
+	var falsePositives int
+	for i := 0; i < 10000; i++ {
+		if ok, _ := f.Test("other-" + strconv.Itoa(i)); ok {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 10000; rate > 0.05 {
+		t.Fatalf("false positive rate too high: %f", rate)
+	}
+	t.Logf("false positives: %d/10000", falsePositives)
+}
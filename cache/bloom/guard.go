@@ -0,0 +1,92 @@
+package bloom
+
+import (
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"time"
+)
+
+// GuardKV 在 utils.IKV 前面加一层布隆过滤器：Get/MGet 时过滤器判定不存在的key直接返回空，不再访问后端；Set时写入过滤器
+//
+//	注意：
+//	1. 通过 Batch 的回调写入的key不会写入过滤器，需要调用 Rebuild 或手动 Filter().Add
+//	2. 布隆过滤器不支持删除，Del之后key仍会被判定为可能存在，只是多一次后端访问
+//	3. 过滤器出错时（比如Redis不可用）直接访问后端
+type GuardKV struct {
+	utils.IKV
+	filter IFilter
+	logger utils.ILogger
+}
+
+var _ utils.IKV = (*GuardKV)(nil)
+
+func NewGuardKV(kv utils.IKV, filter IFilter, logger utils.ILogger) *GuardKV {
+	return &GuardKV{
+		IKV:    kv,
+		filter: filter,
+		logger: logger,
+	}
+}
+
+func (g *GuardKV) Filter() IFilter {
+	return g.filter
+}
+
+func (g *GuardKV) mayExist(key string) bool {
+	ok, err := g.filter.Test(key)
+	if err != nil {
+		g.logger.Errorf("[Bloom]test key \"%s\" error: %s", key, err.Error())
+		return true
+	}
+	return ok
+}
+
+func (g *GuardKV) Get(key string, actual any) ([]byte, error) {
+	if !g.mayExist(key) {
+		return nil, nil
+	}
+	return g.IKV.Get(key, actual)
+}
+
+func (g *GuardKV) MGet(keys []string, actual any) (utils.KVs, error) {
+	var _keys []string
+	for _, key := range keys {
+		if g.mayExist(key) {
+			_keys = append(_keys, key)
+		}
+	}
+	if len(_keys) == 0 {
+		return nil, nil
+	}
+	return g.IKV.MGet(_keys, actual)
+}
+
+func (g *GuardKV) Set(key string, val any, expiration time.Duration) error {
+	if err := g.IKV.Set(key, val, expiration); err != nil {
+		return err
+	}
+	return g.filter.Add(key)
+}
+
+func (g *GuardKV) SetNoExpiration(key string, val any) error {
+	if err := g.IKV.SetNoExpiration(key, val); err != nil {
+		return err
+	}
+	return g.filter.Add(key)
+}
+
+// Rebuild 清空过滤器，并遍历后端中前缀为keyPrefix的所有key写入过滤器，返回写入的数量
+//
+//	重建期间，还未写入的key会被判定为不存在
+func (g *GuardKV) Rebuild(keyPrefix string) (int64, error) {
+	return Rebuild(g.filter, g.IKV, keyPrefix)
+}
+
+// Rebuild 清空filter，并遍历kv中前缀为keyPrefix的所有key写入filter，返回写入的数量
+func Rebuild(filter IFilter, kv utils.IKV, keyPrefix string) (int64, error) {
+	if err := filter.Clear(); err != nil {
+		return 0, err
+	}
+	return kv.ScanPrefixCallback(keyPrefix, func(kv *utils.KV) error {
+		return filter.Add(kv.Key)
+	})
+}
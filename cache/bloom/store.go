@@ -0,0 +1,87 @@
+package bloom
+
+import (
+	"sync"
+)
+
+// IBitStore 布隆过滤器的存储，比如内存、Redis
+type IBitStore interface {
+	// SetBits 将key中offsets的位设为1
+	SetBits(key string, offsets []uint64) error
+	// TestBits key中offsets的位是否都为1
+	TestBits(key string, offsets []uint64) (bool, error)
+	// Incr 计数器加1并返回加之后的值
+	Incr(key string) (int64, error)
+	// Counter 返回计数器的值，不存在时返回0
+	Counter(key string) (int64, error)
+	Del(keys ...string) error
+}
+
+// MemoryBitStore 进程内存中的 IBitStore
+type MemoryBitStore struct {
+	bits     map[string][]uint64
+	counters map[string]int64
+	mu       sync.RWMutex
+}
+
+var _ IBitStore = (*MemoryBitStore)(nil)
+
+func NewMemoryBitStore() *MemoryBitStore {
+	return &MemoryBitStore{
+		bits:     map[string][]uint64{},
+		counters: map[string]int64{},
+	}
+}
+
+func (s *MemoryBitStore) SetBits(key string, offsets []uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bits := s.bits[key]
+	for _, offset := range offsets {
+		i := offset / 64
+		if i >= uint64(len(bits)) { // 按需扩容
+			bits = append(bits, make([]uint64, i+1-uint64(len(bits)))...)
+		}
+		bits[i] |= 1 << (offset % 64)
+	}
+	s.bits[key] = bits
+	return nil
+}
+
+func (s *MemoryBitStore) TestBits(key string, offsets []uint64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bits := s.bits[key]
+	for _, offset := range offsets {
+		i := offset / 64
+		if i >= uint64(len(bits)) || bits[i]&(1<<(offset%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s *MemoryBitStore) Incr(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters[key]++
+	return s.counters[key], nil
+}
+
+func (s *MemoryBitStore) Counter(key string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.counters[key], nil
+}
+
+func (s *MemoryBitStore) Del(keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.bits, key)
+		delete(s.counters, key)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"sync"
+	"time"
+)
+
+// ILocker 跨进程的锁
+type ILocker interface {
+	// TryLock 尝试获取key的锁，不会阻塞；ttl之后锁自动释放（避免持有锁的进程崩溃导致死锁）
+	//  获取成功时返回 true 和解锁函数
+	TryLock(key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
+
+type distributedOptions struct {
+	lockTTL      time.Duration
+	waitTimeout  time.Duration
+	pollInterval time.Duration
+	lockSuffix   string
+}
+
+type DistributedOption func(*distributedOptions)
+
+// WithLockTTL 锁的有效期，应大于loader的执行时间，默认10s
+func WithLockTTL(ttl time.Duration) DistributedOption {
+	return func(o *distributedOptions) {
+		o.lockTTL = ttl
+	}
+}
+
+// WithWaitTimeout 未获得锁时，等待其它进程写入结果的最长时间，超时后自己调用loader，默认3s
+func WithWaitTimeout(timeout time.Duration) DistributedOption {
+	return func(o *distributedOptions) {
+		o.waitTimeout = timeout
+	}
+}
+
+// WithPollInterval 等待时轮询结果的间隔，默认50ms
+func WithPollInterval(interval time.Duration) DistributedOption {
+	return func(o *distributedOptions) {
+		o.pollInterval = interval
+	}
+}
+
+// WithLockSuffix 锁的key为 key + suffix，默认 ":lock"
+func WithLockSuffix(suffix string) DistributedOption {
+	return func(o *distributedOptions) {
+		o.lockSuffix = suffix
+	}
+}
+
+var distributedMu sync.Map
+
+// distributedNil loader返回nil时写入的占位值，等待的进程读到后直接返回nil，不会在超时后再调用loader
+var distributedNil = []byte("\x00cache:distributed:nil\x00")
+
+// IDistributedKV DistributedRemember 使用的kv：通过TierStore读写编码后的原始数据，避免重复编码，并且可以写入 distributedNil
+type IDistributedKV interface {
+	EncoderFunc(v any) ([]byte, error)
+	DecoderFunc(buf []byte, actual any) error
+	TierStore() ITierStore
+}
+
+// DistributedRemember 跨进程的 Remember：先从kv中读取key，不存在时只有获得锁的进程调用loader并写入kv（有效期为expiration）,
+// 其它进程轮询等待结果，等待超时（或锁服务出错）时自己调用loader。并尝试将结果导出到actual 如果无需导出, actual 传入nil
+//
+//	loader返回nil时写入一个占位值（有效期同样为expiration），之后的调用都返回nil, nil
+//	同一进程内相同key的并发调用会先在进程内排队，只有一个会去竞争锁
+func DistributedRemember(kv IDistributedKV, locker ILocker, key string, expiration time.Duration, loader func() (any, error), actual any, options ...DistributedOption) ([]byte, error) {
+	opts := &distributedOptions{
+		lockTTL:      10 * time.Second,
+		waitTimeout:  3 * time.Second,
+		pollInterval: 50 * time.Millisecond,
+		lockSuffix:   ":lock",
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	store := kv.TierStore()
+
+	if buf, ok, err := distributedGet(kv, store, key, actual); err != nil || ok {
+		return buf, err
+	}
+
+	// 基于Key的进程内锁
+	_mu, _ := distributedMu.LoadOrStore(key, &sync.Mutex{})
+	mu := _mu.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+	defer distributedMu.Delete(key)
+
+	if buf, ok, err := distributedGet(kv, store, key, actual); err != nil || ok {
+		return buf, err
+	}
+
+	unlock, ok, err := locker.TryLock(key+opts.lockSuffix, opts.lockTTL)
+	if err != nil { // 锁服务出错时直接自己调用loader
+		return loadAndSet(kv, store, key, expiration, loader, actual)
+	} else if ok {
+		defer unlock()
+		// 获得锁之前，其它进程可能刚写入
+		if buf, ok, err := distributedGet(kv, store, key, actual); err != nil || ok {
+			return buf, err
+		}
+		return loadAndSet(kv, store, key, expiration, loader, actual)
+	}
+
+	// 等待获得锁的进程写入结果
+	deadline := time.Now().Add(opts.waitTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(opts.pollInterval)
+		if buf, ok, err := distributedGet(kv, store, key, actual); err != nil || ok {
+			return buf, err
+		}
+	}
+
+	return loadAndSet(kv, store, key, expiration, loader, actual)
+}
+
+// distributedGet 读取key，ok表示已经有结果（包括 distributedNil，此时返回的buf为nil）
+func distributedGet(kv IDistributedKV, store ITierStore, key string, actual any) (buf []byte, ok bool, err error) {
+	buf, err = store.GetBytes(key)
+	if err != nil || buf == nil {
+		return nil, false, err
+	} else if bytes.Equal(buf, distributedNil) {
+		return nil, true, nil
+	}
+
+	if !core.IsNil(actual) {
+		if err = kv.DecoderFunc(buf, actual); err != nil {
+			return buf, true, errors.WithStack(err)
+		}
+	}
+	return buf, true, nil
+}
+
+func loadAndSet(kv IDistributedKV, store ITierStore, key string, expiration time.Duration, loader func() (any, error), actual any) ([]byte, error) {
+	v, err := loader()
+	if err != nil {
+		return nil, err
+	} else if core.IsNil(v) {
+		return nil, store.SetBytes(key, distributedNil, expiration)
+	}
+
+	buf, err := kv.EncoderFunc(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err = store.SetBytes(key, buf, expiration); err != nil {
+		return nil, err
+	}
+
+	if !core.IsNil(actual) {
+		if err = kv.DecoderFunc(buf, actual); err != nil {
+			return buf, errors.WithStack(err)
+		}
+	}
+	return buf, nil
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testDistributedKV 使用MemoryCache存储、JSON编码的 IDistributedKV，并统计编码次数
+type testDistributedKV struct {
+	*MemoryCache
+	encodes int
+}
+
+func (kv *testDistributedKV) EncoderFunc(v any) ([]byte, error) {
+	kv.encodes++
+	return json.Marshal(v)
+}
+
+func (kv *testDistributedKV) DecoderFunc(buf []byte, actual any) error {
+	return json.Unmarshal(buf, actual)
+}
+
+type testLocker struct {
+	mu    sync.Mutex
+	locks map[string]bool
+}
+
+func (l *testLocker) TryLock(key string, ttl time.Duration) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks[key] {
+		return nil, false, nil
+	}
+	l.locks[key] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.locks, key)
+	}, true, nil
+}
+
+func TestDistributedRemember(t *testing.T) {
+	kv := &testDistributedKV{MemoryCache: NewMemoryCache(DefaultExpiration, time.Minute)}
+	locker := &testLocker{locks: map[string]bool{}}
+
+	var v string
+	buf, err := DistributedRemember(kv, locker, "a", time.Minute, func() (any, error) { return "1", nil }, &v)
+	if err != nil || v != "1" || string(buf) != `"1"` || kv.encodes != 1 {
+		t.Fatalf("remember: %s %s %d %v", v, buf, kv.encodes, err)
+	}
+
+	// loader返回nil时写入占位值，等待锁的调用不会超时后再调用loader
+	unlock, _, _ := locker.TryLock("b:lock", time.Minute)
+	var loads int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf, err := DistributedRemember(kv, locker, "b", time.Minute, func() (any, error) {
+			loads++
+			return nil, nil
+		}, nil, WithWaitTimeout(time.Second), WithPollInterval(10*time.Millisecond))
+		if err != nil || buf != nil {
+			t.Errorf("waiter: %s %v", buf, err)
+		}
+	}()
+	if err = kv.TierStore().SetBytes("b", distributedNil, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	unlock()
+	if loads != 0 {
+		t.Errorf("waiter called loader: %d", loads)
+	}
+
+	for i := 0; i < 2; i++ {
+		if buf, err = DistributedRemember(kv, locker, "c", time.Minute, func() (any, error) {
+			loads++
+			return nil, nil
+		}, nil); err != nil || buf != nil {
+			t.Fatalf("nil result: %s %v", buf, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("nil result should be cached: %d", loads)
+	}
+}
@@ -25,7 +25,7 @@ func NewL2Cache(
 }
 
 func (l *L2Cache) Get(key string, expire time.Duration, actual any) ([]byte, error) {
-	val, err := l.memCache.Remember("get:"+key, expire, func() (any, error) {
+	val, err := RememberTFrom(l.memCache, "get:"+key, expire, func() ([]byte, error) {
 		return l.cache.Get(key, nil)
 	})
 
@@ -33,15 +33,14 @@ func (l *L2Cache) Get(key string, expire time.Duration, actual any) ([]byte, err
 		return nil, err
 	}
 
-	_val, ok := val.([]byte)
-	if ok && _val != nil && !core.IsNil(actual) {
-		if err = l.cache.DecoderFunc(_val, actual); err != nil {
+	if val != nil && !core.IsNil(actual) {
+		if err = l.cache.DecoderFunc(val, actual); err != nil {
 			l.logger.Errorf("[L2]unmarshal: %s of error: %s", val, err.Error())
-			return _val, err
+			return val, err
 		}
 	}
 
-	return _val, nil
+	return val, nil
 }
 
 // MGet 由多个Get构成, 需要维护时, 只需要清理单个Get的缓存即可
@@ -49,14 +48,12 @@ func (l *L2Cache) Get(key string, expire time.Duration, actual any) ([]byte, err
 func (l *L2Cache) MGet(keys []string, expire time.Duration, actual any) (utils.KVs, error) {
 	var _res utils.KVs
 	for _, key := range keys {
-		if val, err := l.memCache.Remember("get:"+key, expire, func() (any, error) {
+		if val, err := RememberTFrom(l.memCache, "get:"+key, expire, func() ([]byte, error) {
 			return l.cache.Get(key, nil)
 		}); err != nil {
 			return nil, err
 		} else {
-			if _val, ok := val.([]byte); ok {
-				_res = _res.Append(key, _val)
-			}
+			_res = _res.Append(key, val)
 		}
 	}
 
@@ -78,26 +75,19 @@ func (l *L2Cache) MGet(keys []string, expire time.Duration, actual any) (utils.K
 }
 
 func (l *L2Cache) Keys(keyPrefix string, expire time.Duration) ([]string, error) {
-	res, err := l.memCache.Remember("keys:"+keyPrefix, expire, func() (any, error) {
+	return RememberTFrom(l.memCache, "keys:"+keyPrefix, expire, func() ([]string, error) {
 		return l.cache.Keys(keyPrefix)
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	_res, _ := res.([]string)
-	return _res, nil
 }
 
 func (l *L2Cache) ScanPrefix(keyPrefix string, expire time.Duration, actual any) (utils.KVs, error) {
-	res, err := l.memCache.Remember("scan-prefix:"+keyPrefix, expire, func() (any, error) {
+	_res, err := RememberTFrom(l.memCache, "scan-prefix:"+keyPrefix, expire, func() (utils.KVs, error) {
 		return l.cache.ScanPrefix(keyPrefix, nil)
 	})
 	if err != nil {
 		return nil, err
 	}
-	_res, ok := res.(utils.KVs)
-	if ok && len(_res) > 0 && !core.IsNil(actual) {
+	if len(_res) > 0 && !core.IsNil(actual) {
 		if err = textUtils.ListDecodeAny(l.cache.DecoderFunc, _res.Values(), actual); err != nil {
 			l.logger.Errorf("[L2]unmarshal: %v of error: %s", _res.Values(), err.Error())
 			return nil, err
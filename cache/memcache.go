@@ -25,6 +25,8 @@ func init() {
 type MemoryCache struct {
 	ocache.Cache
 	mu sync.Map
+
+	snapshotCodec *SnapshotCodec
 }
 
 func NewMemoryCache(defaultExpiration, cleanupInterval time.Duration) *MemoryCache {
@@ -92,3 +94,30 @@ func DeleteExpired() {
 func Flush() {
 	defaultCache.Flush()
 }
+
+type memoryTierStore struct {
+	c *MemoryCache
+}
+
+// TierStore 作为 TieredCache 的一级存储
+func (c *MemoryCache) TierStore() ITierStore {
+	return memoryTierStore{c: c}
+}
+
+func (s memoryTierStore) GetBytes(key string) ([]byte, error) {
+	if v, ok := s.c.Get(key); ok {
+		buf, _ := v.([]byte)
+		return buf, nil
+	}
+	return nil, nil
+}
+
+func (s memoryTierStore) SetBytes(key string, buf []byte, ttl time.Duration) error {
+	s.c.Set(key, buf, core.If(ttl > 0, ttl, NoExpiration))
+	return nil
+}
+
+func (s memoryTierStore) Del(key string) error {
+	s.c.Delete(key)
+	return nil
+}
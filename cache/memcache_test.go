@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"bytes"
 	"testing"
 	"time"
 )
@@ -11,3 +12,27 @@ func TestCache(t *testing.T) {
 	res, _ := c.Get("123")
 	t.Logf("cache 123: %s", res)
 }
+
+func TestSnapshot(t *testing.T) {
+	c := NewMemoryCache(DefaultExpiration, 1*time.Minute)
+	c.Set("a", "1", time.Minute)
+	c.Set("b", 2, NoExpiration)
+	c.Set("expired", "3", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := c.SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := NewMemoryCache(DefaultExpiration, 1*time.Minute)
+	if n, err := c2.LoadFrom(&buf); err != nil || n != 2 {
+		t.Fatalf("load %d, %v", n, err)
+	}
+	if v, exp, ok := c2.GetWithExpiration("a"); !ok || v != "1" || time.Until(exp) > time.Minute {
+		t.Fatalf("a: %v, %s", v, exp)
+	}
+	if v, ok := c2.Get("b"); !ok || v != 2 {
+		t.Fatalf("b: %v", v)
+	}
+}
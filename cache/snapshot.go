@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"encoding/gob"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"io"
+	"os"
+	"time"
+)
+
+type SnapshotEncoder interface {
+	Encode(v any) error
+}
+
+type SnapshotDecoder interface {
+	Decode(v any) error
+}
+
+// SnapshotCodec 快照的编解码，比如 gob、json 的 NewEncoder/NewDecoder
+type SnapshotCodec struct {
+	NewEncoder func(w io.Writer) SnapshotEncoder
+	NewDecoder func(r io.Reader) SnapshotDecoder
+}
+
+// GobSnapshotCodec 默认的快照编解码
+//
+//	注意：gob编码interface时，自定义的类型需要先 gob.Register
+var GobSnapshotCodec = &SnapshotCodec{
+	NewEncoder: func(w io.Writer) SnapshotEncoder { return gob.NewEncoder(w) },
+	NewDecoder: func(r io.Reader) SnapshotDecoder { return gob.NewDecoder(r) },
+}
+
+type snapshotItem struct {
+	Key        string
+	Value      any
+	Expiration int64 // UnixNano，0表示不过期
+}
+
+func (c *MemoryCache) SetSnapshotCodec(codec *SnapshotCodec) *MemoryCache {
+	c.snapshotCodec = codec
+	return c
+}
+
+func (c *MemoryCache) getSnapshotCodec() *SnapshotCodec {
+	return core.If(c.snapshotCodec != nil, c.snapshotCodec, GobSnapshotCodec)
+}
+
+// SaveTo 将所有未过期的数据（包括过期时间）写入w
+func (c *MemoryCache) SaveTo(w io.Writer) error {
+	var items []snapshotItem
+	for k, item := range c.Items() {
+		items = append(items, snapshotItem{Key: k, Value: item.Object, Expiration: item.Expiration})
+	}
+	return errors.WithStack(c.getSnapshotCodec().NewEncoder(w).Encode(items))
+}
+
+// LoadFrom 从r中读取 SaveTo 写入的数据，已经过期的数据会被跳过，返回载入的数量
+func (c *MemoryCache) LoadFrom(r io.Reader) (int, error) {
+	var items []snapshotItem
+	if err := c.getSnapshotCodec().NewDecoder(r).Decode(&items); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var count int
+	now := time.Now().UnixNano()
+	for _, item := range items {
+		if item.Expiration == 0 {
+			c.Set(item.Key, item.Value, NoExpiration)
+		} else if item.Expiration > now {
+			c.Set(item.Key, item.Value, time.Duration(item.Expiration-now))
+		} else {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// SaveToFile 将快照写入文件，先写入临时文件再改名，避免写入中途退出导致文件损坏
+func (c *MemoryCache) SaveToFile(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err = c.SaveTo(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, path))
+}
+
+// LoadFromFile 从文件中读取快照，文件不存在时返回0, nil
+func (c *MemoryCache) LoadFromFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer f.Close()
+	return c.LoadFrom(f)
+}
+
+// AutoSnapshot 立即从path载入快照，并在收到进程退出信号（见 core.ListenStopSignal）时将快照写入path
+//
+//	返回的saved会在快照写入完成或ctx结束后关闭，在进程退出前等待它可以确保快照写入完成
+//	例子:
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//	saved, _ := c.AutoSnapshot(ctx, "/data/cache.snapshot")
+//	...
+//	<-saved
+func (c *MemoryCache) AutoSnapshot(ctx context.Context, path string) (saved <-chan struct{}, err error) {
+	if _, err = c.LoadFromFile(path); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan struct{})
+	signalCtx, signalCancel := context.WithCancel(context.Background())
+	core.ListenStopSignal(ctx, signalCancel)
+	go func() {
+		defer close(ch)
+		defer signalCancel()
+		select {
+		case <-signalCtx.Done():
+		case <-ctx.Done():
+		}
+		if signalCtx.Err() == nil { // 不是因为退出信号
+			return
+		}
+		if err := c.SaveToFile(path); err != nil {
+			utils.GetGlobalILogger().Errorf("[MemoryCache]save snapshot to \"%s\" error: %s", path, err.Error())
+		}
+	}()
+	return ch, nil
+}
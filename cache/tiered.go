@@ -0,0 +1,288 @@
+package cache
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"sync"
+	"time"
+)
+
+// ITierStore 多级缓存中的一级存储，存取的都是编码之后的数据
+type ITierStore interface {
+	// GetBytes 读取key的原始数据，不存在时返回nil, nil
+	GetBytes(key string) ([]byte, error)
+	// SetBytes 写入key的原始数据，ttl <= 0 表示不过期
+	SetBytes(key string, buf []byte, ttl time.Duration) error
+	Del(key string) error
+}
+
+// LoaderFunc 所有层级都未命中时，从数据源加载数据，返回nil表示数据不存在（不会写入缓存）
+type LoaderFunc func(key string) (any, error)
+
+type tier struct {
+	name  string
+	store ITierStore
+	ttl   time.Duration
+}
+
+// tieredTombstone write-behind 模式下删除时写入第一级的标记，后台删除完成之前，Get不会从下面的层级读到旧数据并回填
+var tieredTombstone = []byte("\x00tiered:deleted\x00")
+
+type tieredJob struct {
+	key    string
+	buf    []byte
+	delete bool
+}
+
+// TieredCache 多级缓存，比如：内存 -> 本地Badger -> Redis -> LoaderFunc
+//
+//	读：从上往下逐级查找，命中后回填到上面的各级；全部未命中时调用LoaderFunc并回填所有层级
+//	写：write-through 模式同步写入所有层级；write-behind 模式只同步写入第一级，其余层级由后台队列依次写入
+//	某一级出错（比如Redis短暂不可用）时只记录日志，会继续使用其它层级
+type TieredCache struct {
+	tiers  []*tier
+	loader LoaderFunc
+	logger utils.ILogger
+
+	decoderFunc textUtils.DecoderFunc
+	encoderFunc textUtils.EncoderFunc
+
+	keyMu sync.Map
+
+	writeBehind bool
+	queue       chan *tieredJob
+	pending     sync.WaitGroup
+	closed      bool
+	closeMu     sync.RWMutex
+	wg          sync.WaitGroup
+}
+
+type TieredOption func(*TieredCache)
+
+// WithTier 添加一级缓存，按添加的顺序从上往下排列，ttl <= 0 表示不过期
+func WithTier(name string, store ITierStore, ttl time.Duration) TieredOption {
+	return func(c *TieredCache) {
+		c.tiers = append(c.tiers, &tier{name: name, store: store, ttl: ttl})
+	}
+}
+
+// WithLoader 设置所有层级都未命中时的加载函数
+func WithLoader(loader LoaderFunc) TieredOption {
+	return func(c *TieredCache) {
+		c.loader = loader
+	}
+}
+
+// WithWriteBehind 使用write-behind模式，queueSize为后台写入队列的长度，队列满时写入会阻塞
+func WithWriteBehind(queueSize int) TieredOption {
+	return func(c *TieredCache) {
+		c.writeBehind = true
+		c.queue = make(chan *tieredJob, queueSize)
+	}
+}
+
+func NewTieredCache(logger utils.ILogger, options ...TieredOption) *TieredCache {
+	c := &TieredCache{
+		logger:      logger,
+		encoderFunc: textUtils.JsonMarshalToBytes,
+		decoderFunc: textUtils.JsonUnmarshalFromBytes,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	if c.writeBehind {
+		c.wg.Add(1)
+		go c.runQueue()
+	}
+	return c
+}
+
+func (c *TieredCache) SetEncoderFunc(encoderFunc textUtils.EncoderFunc) *TieredCache {
+	c.encoderFunc = encoderFunc
+	return c
+}
+
+func (c *TieredCache) EncoderFunc(v any) ([]byte, error) {
+	return c.encoderFunc(v)
+}
+
+func (c *TieredCache) SetDecoderFunc(decoderFunc textUtils.DecoderFunc) *TieredCache {
+	c.decoderFunc = decoderFunc
+	return c
+}
+
+func (c *TieredCache) DecoderFunc(buf []byte, actual any) error {
+	return c.decoderFunc(buf, actual)
+}
+
+// Get 查询key的值, 并尝试将其值导出到actual 如果无需导出, actual 传入nil
+func (c *TieredCache) Get(key string, actual any) ([]byte, error) {
+	buf, err := c.get(key)
+	if err != nil || buf == nil {
+		return nil, err
+	}
+
+	if !core.IsNil(actual) {
+		if err = c.decoderFunc(buf, actual); err != nil {
+			c.logger.Errorf("[Tiered]unmarshal: %s of error: %s", buf, err.Error())
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+func (c *TieredCache) get(key string) ([]byte, error) {
+	if buf, ok := c.getFromTiers(key); ok {
+		return buf, nil
+	} else if c.loader == nil {
+		return nil, nil
+	}
+
+	// 基于Key的锁, 避免并发时多次调用loader
+	_mu, _ := c.keyMu.LoadOrStore(key, &sync.Mutex{})
+	mu := _mu.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+	defer c.keyMu.Delete(key)
+
+	if buf, ok := c.getFromTiers(key); ok {
+		return buf, nil
+	}
+
+	v, err := c.loader(key)
+	if err != nil {
+		return nil, err
+	} else if core.IsNil(v) {
+		return nil, nil
+	}
+
+	buf, err := c.encoderFunc(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c.fill(key, buf, len(c.tiers))
+	return buf, nil
+}
+
+// getFromTiers 从上往下逐级查找，命中后回填到上面的各级
+func (c *TieredCache) getFromTiers(key string) ([]byte, bool) {
+	for i, t := range c.tiers {
+		buf, err := t.store.GetBytes(key)
+		if err != nil {
+			c.logger.Errorf("[Tiered]get \"%s\" from tier \"%s\" error: %s", key, t.name, err.Error())
+			continue
+		} else if i == 0 && c.writeBehind && bytes.Equal(buf, tieredTombstone) { // 已经删除
+			return nil, false
+		} else if buf != nil {
+			c.fill(key, buf, i)
+			return buf, true
+		}
+	}
+	return nil, false
+}
+
+// fill 将数据写入前n级
+func (c *TieredCache) fill(key string, buf []byte, n int) {
+	for _, t := range c.tiers[:n] {
+		if err := t.store.SetBytes(key, buf, t.ttl); err != nil {
+			c.logger.Errorf("[Tiered]fill \"%s\" to tier \"%s\" error: %s", key, t.name, err.Error())
+		}
+	}
+}
+
+// Set 写入所有层级，write-behind 模式下除第一级之外的层级在后台写入
+func (c *TieredCache) Set(key string, val any) error {
+	buf, err := c.encoderFunc(val)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return c.write(&tieredJob{key: key, buf: buf})
+}
+
+// Delete 从所有层级中删除，write-behind 模式下第一级写入删除的标记（ttl与第一级相同），其余层级在后台删除
+func (c *TieredCache) Delete(keys ...string) error {
+	var errs error
+	for _, key := range keys {
+		errs = multierr.Append(errs, c.write(&tieredJob{key: key, delete: true}))
+	}
+	return errs
+}
+
+func (c *TieredCache) write(job *tieredJob) error {
+	if !c.writeBehind || len(c.tiers) == 0 {
+		return c.apply(job, c.tiers)
+	}
+
+	c.closeMu.RLock()
+	defer c.closeMu.RUnlock()
+	if c.closed { // 已经关闭，直接同步写入
+		return c.apply(job, c.tiers)
+	}
+
+	first := job
+	if job.delete {
+		first = &tieredJob{key: job.key, buf: tieredTombstone}
+	}
+	if err := c.apply(first, c.tiers[:1]); err != nil {
+		return err
+	}
+	c.pending.Add(1)
+	c.queue <- job
+	return nil
+}
+
+// apply 将job写入到tiers，某一级出错时继续写入其它层级，返回所有的错误
+func (c *TieredCache) apply(job *tieredJob, tiers []*tier) error {
+	var errs error
+	for _, t := range tiers {
+		var err error
+		if job.delete {
+			err = t.store.Del(job.key)
+		} else {
+			err = t.store.SetBytes(job.key, job.buf, t.ttl)
+		}
+		if err != nil {
+			errs = multierr.Append(errs, errors.WithMessagef(err, "tier \"%s\"", t.name))
+		}
+	}
+	return errs
+}
+
+func (c *TieredCache) runQueue() {
+	defer c.wg.Done()
+	for job := range c.queue {
+		if err := c.apply(job, c.tiers[1:]); err != nil {
+			c.logger.Errorf("[Tiered]write-behind \"%s\" error: %s", job.key, err.Error())
+		}
+		c.pending.Done()
+	}
+}
+
+// Flush 等待write-behind队列中的数据全部写入
+func (c *TieredCache) Flush() {
+	c.pending.Wait()
+}
+
+// Close 写完write-behind队列中的数据后关闭，不会关闭各级的存储
+func (c *TieredCache) Close() error {
+	if !c.writeBehind {
+		return nil
+	}
+
+	c.closeMu.Lock()
+	if c.closed {
+		c.closeMu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.queue)
+	c.closeMu.Unlock()
+
+	c.wg.Wait()
+	return nil
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"testing"
+	"time"
+)
+
+func TestTieredCache(t *testing.T) {
+	l1 := NewMemoryCache(DefaultExpiration, 1*time.Minute)
+	l2 := NewMemoryCache(DefaultExpiration, 1*time.Minute)
+	loads := 0
+	c := NewTieredCache(utils.NewDefaultLogger(),
+		WithTier("l1", l1.TierStore(), time.Minute),
+		WithTier("l2", l2.TierStore(), time.Hour),
+		WithLoader(func(key string) (any, error) {
+			loads++
+			return "value of " + key, nil
+		}),
+		WithWriteBehind(10),
+	)
+	defer c.Close()
+
+	var v string
+	if _, err := c.Get("a", &v); err != nil || v != "value of a" {
+		t.Fatalf("get a: %s, %v", v, err)
+	}
+
+	l1.Flush() // l1未命中时，从l2回填
+	if _, err := c.Get("a", nil); err != nil || loads != 1 {
+		t.Fatalf("loads: %d, %v", loads, err)
+	}
+	if _, ok := l1.Get("a"); !ok {
+		t.Fatal("l1 not filled")
+	}
+
+	if err := c.Set("b", "1"); err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+	if _, ok := l2.Get("b"); !ok {
+		t.Fatal("l2 not written")
+	}
+}
+
+// blockingDelStore 在release关闭之前阻塞Del，模拟后台删除还未完成
+type blockingDelStore struct {
+	ITierStore
+	release chan struct{}
+}
+
+func (s blockingDelStore) Del(key string) error {
+	<-s.release
+	return s.ITierStore.Del(key)
+}
+
+func TestTieredCacheWriteBehindDelete(t *testing.T) {
+	l1 := NewMemoryCache(DefaultExpiration, 1*time.Minute)
+	l2 := NewMemoryCache(DefaultExpiration, 1*time.Minute)
+	release := make(chan struct{})
+	c := NewTieredCache(utils.NewDefaultLogger(),
+		WithTier("l1", l1.TierStore(), time.Minute),
+		WithTier("l2", blockingDelStore{l2.TierStore(), release}, time.Hour),
+		WithWriteBehind(10),
+	)
+	defer c.Close()
+
+	if err := c.Set("a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	c.Flush()
+
+	// 在后台删除l2之前读取，不能从l2回填旧数据
+	if err := c.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err := c.Get("a", nil); err != nil || buf != nil {
+		t.Errorf("get deleted: %s, %v", buf, err)
+	}
+	close(release)
+	c.Flush()
+	if _, ok := l2.Get("a"); ok {
+		t.Error("l2 not deleted")
+	}
+}
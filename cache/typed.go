@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"github.com/pkg/errors"
+	"time"
+)
+
+// GetT 从默认缓存中读取k，不存在或者类型不是T时返回 false
+func GetT[T any](k string) (T, bool) {
+	return GetTFrom[T](defaultCache, k)
+}
+
+// SetT 写入默认缓存
+func SetT[T any](k string, v T, expire time.Duration) {
+	defaultCache.Set(k, v, expire)
+}
+
+// RememberT 泛型版本的 Remember
+func RememberT[T any](k string, expire time.Duration, callback func() (T, error)) (T, error) {
+	return RememberTFrom[T](defaultCache, k, expire, callback)
+}
+
+// GetTFrom 从c中读取k，不存在或者类型不是T时返回 false
+func GetTFrom[T any](c *MemoryCache, k string) (T, bool) {
+	v, ok := c.Get(k)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	t, ok := v.(T)
+	return t, ok
+}
+
+// RememberTFrom 泛型版本的 MemoryCache.Remember，如果缓存中已有的值类型不是T，返回错误
+func RememberTFrom[T any](c *MemoryCache, k string, expire time.Duration, callback func() (T, error)) (T, error) {
+	v, err := c.Remember(k, expire, func() (any, error) {
+		return callback()
+	})
+
+	t, ok := v.(T)
+	if err != nil {
+		return t, err
+	} else if !ok && v != nil {
+		return t, errors.Errorf("cache value of key \"%s\" is %T, not %T", k, v, t)
+	}
+	return t, nil
+}
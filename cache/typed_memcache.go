@@ -0,0 +1,206 @@
+package cache
+
+import (
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"runtime"
+	"sync"
+	"time"
+)
+
+type typedItem[V any] struct {
+	value      V
+	expiration int64
+}
+
+func (item typedItem[V]) expired(now int64) bool {
+	return item.expiration > 0 && now > item.expiration
+}
+
+// TypedMemoryCache 泛型版本的 MemoryCache，过期、定时清理、Remember的单key锁 与 MemoryCache 一致
+type TypedMemoryCache[K comparable, V any] struct {
+	*typedMemoryCache[K, V]
+	// 参考 go-cache：外层对象被回收时，通过finalizer停止清理协程
+}
+
+type typedMemoryCache[K comparable, V any] struct {
+	defaultExpiration time.Duration
+	items             map[K]typedItem[V]
+	mu                sync.RWMutex
+	keyMu             sync.Map
+	onEvicted         func(K, V)
+	stopCh            chan struct{}
+}
+
+// NewTypedMemoryCache defaultExpiration 为 DefaultExpiration 或 NoExpiration 时表示默认不过期，cleanupInterval <= 0 表示不定时清理过期数据
+func NewTypedMemoryCache[K comparable, V any](defaultExpiration, cleanupInterval time.Duration) *TypedMemoryCache[K, V] {
+	if defaultExpiration == DefaultExpiration {
+		defaultExpiration = NoExpiration
+	}
+	c := &typedMemoryCache[K, V]{
+		defaultExpiration: defaultExpiration,
+		items:             map[K]typedItem[V]{},
+	}
+	C := &TypedMemoryCache[K, V]{c}
+	if cleanupInterval > 0 {
+		c.stopCh = make(chan struct{})
+		go c.runCleanup(cleanupInterval)
+		runtime.SetFinalizer(C, func(C *TypedMemoryCache[K, V]) {
+			close(C.stopCh)
+		})
+	}
+	return C
+}
+
+func (c *typedMemoryCache[K, V]) runCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *typedMemoryCache[K, V]) set(k K, v V, expire time.Duration) {
+	if expire == DefaultExpiration {
+		expire = c.defaultExpiration
+	}
+	var e int64
+	if expire > 0 {
+		e = time.Now().Add(expire).UnixNano()
+	}
+	c.items[k] = typedItem[V]{value: v, expiration: e}
+}
+
+// Set 写入k，expire 为 DefaultExpiration 表示使用默认的过期时间，为 NoExpiration 表示不过期
+func (c *typedMemoryCache[K, V]) Set(k K, v V, expire time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(k, v, expire)
+}
+
+func (c *typedMemoryCache[K, V]) SetDefault(k K, v V) {
+	c.Set(k, v, DefaultExpiration)
+}
+
+func (c *typedMemoryCache[K, V]) SetNoExpiration(k K, v V) {
+	c.Set(k, v, NoExpiration)
+}
+
+// Get 读取k，不存在或已过期时返回 false
+func (c *typedMemoryCache[K, V]) Get(k K) (V, bool) {
+	v, _, ok := c.GetWithExpiration(k)
+	return v, ok
+}
+
+// GetWithExpiration 读取k及其过期时间，不过期时返回零值的time.Time
+func (c *typedMemoryCache[K, V]) GetWithExpiration(k K) (V, time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, ok := c.items[k]
+	if !ok || item.expired(time.Now().UnixNano()) {
+		var zero V
+		return zero, time.Time{}, false
+	}
+	if item.expiration > 0 {
+		return item.value, time.Unix(0, item.expiration), true
+	}
+	return item.value, time.Time{}, true
+}
+
+func (c *typedMemoryCache[K, V]) Delete(k K) {
+	c.mu.Lock()
+	item, ok := c.items[k]
+	delete(c.items, k)
+	c.mu.Unlock()
+
+	if ok && c.onEvicted != nil {
+		c.onEvicted(k, item.value)
+	}
+}
+
+// DeleteExpired 删除所有已过期的数据
+func (c *typedMemoryCache[K, V]) DeleteExpired() {
+	var evicted []K
+	var values []V
+	now := time.Now().UnixNano()
+
+	c.mu.Lock()
+	for k, item := range c.items {
+		if item.expired(now) {
+			delete(c.items, k)
+			if c.onEvicted != nil {
+				evicted = append(evicted, k)
+				values = append(values, item.value)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for i, k := range evicted {
+		c.onEvicted(k, values[i])
+	}
+}
+
+// OnEvicted 设置数据被删除（包括过期被清理）时的回调，Flush 不会触发回调
+func (c *typedMemoryCache[K, V]) OnEvicted(fn func(K, V)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onEvicted = fn
+}
+
+// Items 返回所有未过期的数据
+func (c *typedMemoryCache[K, V]) Items() map[K]V {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now().UnixNano()
+	items := make(map[K]V, len(c.items))
+	for k, item := range c.items {
+		if !item.expired(now) {
+			items[k] = item.value
+		}
+	}
+	return items
+}
+
+// ItemCount 返回数据的数量，包括已过期但还未被清理的数据
+func (c *typedMemoryCache[K, V]) ItemCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.items)
+}
+
+func (c *typedMemoryCache[K, V]) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = map[K]typedItem[V]{}
+}
+
+// Remember 读取k，不存在时调用callback并写入缓存。同一个k的并发调用只会执行一次callback
+//
+//	callback返回的是nil指针时不会写入缓存
+func (c *typedMemoryCache[K, V]) Remember(k K, expire time.Duration, callback func() (V, error)) (V, error) {
+	// 基于Key的锁
+	_mu, _ := c.keyMu.LoadOrStore(k, &sync.Mutex{})
+	mu := _mu.(*sync.Mutex)
+	mu.Lock()
+	defer mu.Unlock()
+	defer c.keyMu.Delete(k)
+
+	if v, ok := c.Get(k); ok {
+		return v, nil
+	}
+
+	v, err := callback()
+	if err != nil {
+		return v, err
+	} else if !core.IsNil(v) { // 只有非nil时才能存储
+		c.Set(k, v, expire)
+	}
+	return v, nil
+}
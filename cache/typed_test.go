@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRememberT(t *testing.T) {
+	SetT("typed-int", 1, time.Minute)
+	if v, ok := GetT[int]("typed-int"); !ok || v != 1 {
+		t.Fatalf("GetT: %d, %v", v, ok)
+	}
+	if _, ok := GetT[string]("typed-int"); ok {
+		t.Fatal("GetT with wrong type should return false")
+	}
+	if _, err := RememberT("typed-int", time.Minute, func() (string, error) { return "a", nil }); err == nil {
+		t.Fatal("RememberT with wrong type should return error")
+	}
+}
+
+func TestTypedMemoryCache(t *testing.T) {
+	c := NewTypedMemoryCache[int, string](DefaultExpiration, time.Minute)
+	c.Set(1, "a", 50*time.Millisecond)
+
+	calls := 0
+	for i := 0; i < 2; i++ {
+		v, err := c.Remember(2, NoExpiration, func() (string, error) {
+			calls++
+			return "b", nil
+		})
+		if err != nil || v != "b" {
+			t.Fatalf("Remember: %s, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("callback called %d times", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := c.Get(1); ok {
+		t.Fatal("key 1 should be expired")
+	}
+	if v, ok := c.Get(2); !ok || v != "b" {
+		t.Fatalf("Get 2: %s, %v", v, ok)
+	}
+}
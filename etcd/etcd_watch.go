@@ -58,11 +58,11 @@ func (w *EtcdWatch) DumpAndWatch(ctx context.Context, keyPrefix string, fromRevi
 	var revision int64
 	var err error
 	if revision, err = w.Dump(ctx, keyPrefix, fromRevision, -1, handle); err != nil {
-		return revision, errors.Errorf("dump cc from etcd error: %w", err)
+		return revision, errors.WithMessage(err, "dump cc from etcd error")
 	}
 
 	if revision, err = w.Watch(ctx, keyPrefix, revision+1, handle); err != nil {
-		return revision, errors.Errorf("watch cc from etcd error: %w", err)
+		return revision, errors.WithMessage(err, "watch cc from etcd error")
 	}
 
 	return revision, nil
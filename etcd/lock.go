@@ -0,0 +1,40 @@
+package etcd
+
+import (
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gopkg.in/go-mixed/go-common.v1/cache.v1"
+	"math"
+	"time"
+)
+
+// TryLock 使用lease + 事务尝试获取key的锁，ttl之后（最小1s）lease过期，锁自动释放；获取成功时返回 true 和解锁函数
+func (c *Etcd) TryLock(key string, ttl time.Duration) (unlock func(), ok bool, err error) {
+	lease, err := c.EtcdClient.Grant(c.Ctx, int64(math.Max(1, math.Ceil(ttl.Seconds()))))
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	response, err := c.EtcdClient.Txn(c.Ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, "", clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil || !response.Succeeded {
+		if _, _err := c.EtcdClient.Revoke(c.Ctx, lease.ID); _err != nil {
+			c.Logger.Errorf("[ETCD]revoke lease %d error: %s", lease.ID, _err.Error())
+		}
+		return nil, false, errors.WithStack(err)
+	}
+
+	return func() {
+		// 撤销lease会同时删除key
+		if _, err := c.EtcdClient.Revoke(c.Ctx, lease.ID); err != nil {
+			c.Logger.Errorf("[ETCD]unlock %s error: %s", key, err.Error())
+		}
+	}, true, nil
+}
+
+// DistributedRemember 跨进程的 Remember，只有获得锁的进程会调用loader，详见 cache.DistributedRemember
+func (c *Etcd) DistributedRemember(key string, expiration time.Duration, loader func() (any, error), actual any, options ...cache.DistributedOption) ([]byte, error) {
+	return cache.DistributedRemember(c, c, key, expiration, loader, actual, options...)
+}
@@ -0,0 +1,44 @@
+package etcd
+
+import (
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gopkg.in/go-mixed/go-common.v1/cache.v1"
+	"time"
+)
+
+type etcdTierStore struct {
+	c *Etcd
+}
+
+// TierStore 作为 cache.TieredCache 的一级存储，读写的都是原始数据，不经过EncoderFunc/DecoderFunc
+func (c *Etcd) TierStore() cache.ITierStore {
+	return etcdTierStore{c: c}
+}
+
+func (s etcdTierStore) GetBytes(key string) ([]byte, error) {
+	response, err := s.c.EtcdClient.Get(s.c.Ctx, key, clientv3.WithLimit(1))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	} else if len(response.Kvs) == 0 || len(response.Kvs[0].Value) == 0 {
+		return nil, nil
+	}
+	return response.Kvs[0].Value, nil
+}
+
+func (s etcdTierStore) SetBytes(key string, buf []byte, ttl time.Duration) error {
+	var options []clientv3.OpOption
+	if seconds := int64(ttl.Seconds()); seconds > 0 {
+		lease, err := s.c.EtcdClient.Grant(s.c.Ctx, seconds)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		options = append(options, clientv3.WithLease(lease.ID))
+	}
+	_, err := s.c.EtcdClient.Put(s.c.Ctx, key, string(buf), options...)
+	return errors.WithStack(err)
+}
+
+func (s etcdTierStore) Del(key string) error {
+	return s.c.Del(key)
+}
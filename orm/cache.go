@@ -0,0 +1,471 @@
+package orm
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelCache 模型的读缓存（read-through），存储在任意的 utils.IKV 中，只有 Register 过的模型才会被缓存
+//
+//	cache := orm.NewModelCache(redis, zapLogger).
+//		Register(&User{}, orm.WithCacheTTL(time.Minute)).
+//		Register(&Role{}, orm.WithCacheTags("acl"))
+//	o, err := orm.NewQuickOrm(db).WithCache(cache)
+//	o.GetModel(Where{"id": 1}, &user)          // 按主键缓存
+//	o.GetModels(Where{"status": 1}, &users)    // 按查询条件缓存
+//
+// 通过gorm（包括QuickOrm）的 Create/Update/Delete 会更新主键的版本使其缓存失效，并使该模型的查询缓存以及声明的tags失效；
+// 没有主键的批量修改（比如 UpdateModels(&User{}, Where{...})）会使该模型所有的主键缓存失效。
+// Exec/Raw 无法得知修改的模型，需要手动调用 InvalidateModel 或 InvalidateTags。
+//
+// 注意：事务中的修改在提交之前就会使缓存失效，如果在提交之前有并发的读取，旧数据会一直缓存到TTL过期
+type ModelCache struct {
+	kv         utils.IKV
+	logger     *zap.SugaredLogger
+	prefix     string
+	defaultTTL time.Duration
+
+	mu     sync.RWMutex
+	models map[reflect.Type]*cachedModel
+}
+
+type cachedModel struct {
+	ttl  time.Duration
+	tags []string
+}
+
+// modelCacheEntry 缓存的值，Versions为写入时tags的版本，读取时版本不一致即为失效
+type modelCacheEntry struct {
+	Versions []int64
+	N        int64
+	Data     []byte
+}
+
+type ModelCacheOption func(c *ModelCache)
+
+// WithModelCachePrefix key的前缀，默认为 "orm:"
+func WithModelCachePrefix(prefix string) ModelCacheOption {
+	return func(c *ModelCache) {
+		c.prefix = prefix
+	}
+}
+
+// WithModelCacheTTL 模型没有设置TTL时的默认TTL，默认为5分钟
+func WithModelCacheTTL(ttl time.Duration) ModelCacheOption {
+	return func(c *ModelCache) {
+		c.defaultTTL = ttl
+	}
+}
+
+type CachedModelOption func(m *cachedModel)
+
+// WithCacheTTL 该模型的缓存时间
+func WithCacheTTL(ttl time.Duration) CachedModelOption {
+	return func(m *cachedModel) {
+		m.ttl = ttl
+	}
+}
+
+// WithCacheTags 该模型的查询缓存依赖的tags，修改该模型时也会使这些tags失效，
+// 所以声明了相同tag的模型，其中一个被修改时，其它模型的查询缓存也会失效
+func WithCacheTags(tags ...string) CachedModelOption {
+	return func(m *cachedModel) {
+		m.tags = append(m.tags, tags...)
+	}
+}
+
+func NewModelCache(kv utils.IKV, zapLogger *zap.Logger, options ...ModelCacheOption) *ModelCache {
+	c := &ModelCache{
+		kv:         kv,
+		logger:     zapLogger.Sugar(),
+		prefix:     "orm:",
+		defaultTTL: 5 * time.Minute,
+		models:     map[reflect.Type]*cachedModel{},
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Register 启用模型的缓存，model为模型的指针，比如 &User{}
+func (c *ModelCache) Register(model any, options ...CachedModelOption) *ModelCache {
+	m := &cachedModel{ttl: c.defaultTTL}
+	for _, option := range options {
+		option(m)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.models[indirectType(reflect.TypeOf(model))] = m
+	return c
+}
+
+func (c *ModelCache) model(modelType reflect.Type) *cachedModel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.models[modelType]
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
+
+type noCacheKey struct{}
+
+// WithoutCache 返回一个新的ctx，使用此ctx（db.WithContext(ctx)）的查询不读取也不写入缓存
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// WithCache 返回一个使用cache的新QuickOrm，不会修改原QuickOrm。
+// db没有注册cache时会注册（db.Use(cache)），用于在写入时使缓存失效；
+// 一个db只能注册一个 ModelCache，已经注册了其它的 ModelCache 时返回错误（否则写入时不会使此cache失效）
+func (o *QuickOrm) WithCache(cache *ModelCache) (*QuickOrm, error) {
+	if registered, ok := o.DB.Config.Plugins[cache.Name()]; !ok {
+		if err := o.DB.Use(cache); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else if registered != cache {
+		return nil, errors.Errorf("another ModelCache is already registered on this db")
+	}
+	return &QuickOrm{DB: o.DB, defaultWhere: o.defaultWhere, versionColumn: o.versionColumn, cache: cache}, nil
+}
+
+var _ gorm.Plugin = (*ModelCache)(nil)
+
+const modelCachePluginName = "orm:model_cache"
+
+func (c *ModelCache) Name() string {
+	return modelCachePluginName
+}
+
+// Initialize 实现 gorm.Plugin，注册写入之后使缓存失效的callback
+func (c *ModelCache) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	for _, err := range []error{
+		callback.Create().After("gorm:create").Register(c.Name(), c.afterCreate),
+		callback.Update().After("gorm:update").Register(c.Name(), c.afterWrite),
+		callback.Delete().After("gorm:delete").Register(c.Name(), c.afterWrite),
+	} {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (c *ModelCache) tagKey(tag string) string {
+	return c.prefix + "tag:" + tag
+}
+
+// queryTagKeys 模型的查询缓存依赖的tags：表名以及声明的tags
+func (c *ModelCache) queryTagKeys(sch *schema.Schema, m *cachedModel) []string {
+	keys := []string{c.tagKey(sch.Table)}
+	for _, tag := range m.tags {
+		keys = append(keys, c.tagKey(tag))
+	}
+	return keys
+}
+
+// pkTagKey 模型所有主键缓存依赖的tag
+func (c *ModelCache) pkTagKey(sch *schema.Schema) string {
+	return c.tagKey(sch.Table + ":pk")
+}
+
+func (c *ModelCache) pkKey(sch *schema.Schema, pk any) string {
+	return fmt.Sprintf("%s%s:pk:%v", c.prefix, sch.Table, pk)
+}
+
+// pkVersionKey 单个主键缓存的版本，修改时更新版本而不是删除缓存：
+// 并发的读取在修改之前读到的是旧版本，即使在修改之后才写入旧数据，也会因为版本不一致而失效
+func (c *ModelCache) pkVersionKey(sch *schema.Schema, pk any) string {
+	return fmt.Sprintf("%s%s:pkv:%v", c.prefix, sch.Table, pk)
+}
+
+// InvalidateTags 使依赖这些tags的查询缓存失效，tag可以是表名或者 WithCacheTags 中声明的tag
+func (c *ModelCache) InvalidateTags(tags ...string) error {
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, c.tagKey(tag))
+	}
+	return c.bump(keys...)
+}
+
+// InvalidateModel 使模型所有的缓存（主键和查询）失效，用于 Exec/Raw 等无法自动失效的修改
+func (c *ModelCache) InvalidateModel(db *gorm.DB, model any) error {
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return err
+	}
+	m := c.model(sch.ModelType)
+	if m == nil {
+		return nil
+	}
+	return c.bump(append(c.queryTagKeys(sch, m), c.pkTagKey(sch))...)
+}
+
+// bump 更新tags的版本，使用旧版本写入的缓存都会失效
+func (c *ModelCache) bump(tagKeys ...string) error {
+	version := time.Now().UnixNano()
+	for _, key := range tagKeys {
+		if err := c.kv.SetNoExpiration(key, version); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// bumpPK 更新主键的版本。主键很多，所以版本会过期：版本不会重复，过期之后读取时会写入新的版本，旧的缓存仍然是失效的
+func (c *ModelCache) bumpPK(ttl time.Duration, versionKeys ...string) error {
+	version := time.Now().UnixNano()
+	for _, key := range versionKeys {
+		if err := c.kv.Set(key, version, ttl); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (c *ModelCache) afterCreate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	if m := c.model(db.Statement.Schema.ModelType); m != nil {
+		tagKeys := c.queryTagKeys(db.Statement.Schema, m)
+		// upsert 可能修改了已存在的行，插入之后回填的主键不可靠
+		if _, ok := db.Statement.Clauses["ON CONFLICT"]; ok {
+			tagKeys = append(tagKeys, c.pkTagKey(db.Statement.Schema))
+		}
+		if err := c.bump(tagKeys...); err != nil {
+			c.logger.Errorf("[ORM]invalidate cache of %s: %s", db.Statement.Table, err.Error())
+		}
+	}
+}
+
+func (c *ModelCache) afterWrite(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	sch := db.Statement.Schema
+	m := c.model(sch.ModelType)
+	if m == nil {
+		return
+	}
+
+	tagKeys := c.queryTagKeys(sch, m)
+	if pks, ok := primaryKeys(db); ok {
+		versionKeys := make([]string, 0, len(pks))
+		for _, pk := range pks {
+			versionKeys = append(versionKeys, c.pkVersionKey(sch, pk))
+		}
+		if err := c.bumpPK(m.ttl, versionKeys...); err != nil {
+			c.logger.Errorf("[ORM]invalidate cache of %s: %s", sch.Table, err.Error())
+		}
+	} else { // 不知道修改了哪些主键
+		tagKeys = append(tagKeys, c.pkTagKey(sch))
+	}
+	if err := c.bump(tagKeys...); err != nil {
+		c.logger.Errorf("[ORM]invalidate cache of %s: %s", sch.Table, err.Error())
+	}
+}
+
+// primaryKeys 返回Statement中模型的主键，有一个模型没有主键时返回false
+func primaryKeys(db *gorm.DB) ([]any, bool) {
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	if field == nil {
+		return nil, false
+	}
+
+	rv := db.Statement.ReflectValue
+	if rv.Kind() != reflect.Struct && rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array && db.Statement.Model != nil {
+		rv = reflect.Indirect(reflect.ValueOf(db.Statement.Model))
+	}
+	ctx := db.Statement.Context
+	var pks []any
+	switch rv.Kind() {
+	case reflect.Struct:
+		pk, zero := field.ValueOf(ctx, rv)
+		if zero {
+			return nil, false
+		}
+		pks = append(pks, pk)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			pk, zero := field.ValueOf(ctx, reflect.Indirect(rv.Index(i)))
+			if zero {
+				return nil, false
+			}
+			pks = append(pks, pk)
+		}
+	default:
+		return nil, false
+	}
+	return pks, len(pks) > 0
+}
+
+func parseSchema(db *gorm.DB, model any) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return stmt.Schema, nil
+}
+
+// usable 不在事务中、ctx中没有 WithoutCache 时才使用缓存
+func (c *ModelCache) usable(db *gorm.DB) bool {
+	if db.DryRun {
+		return false
+	}
+	if ctx := db.Statement.Context; ctx != nil {
+		if noCache, _ := ctx.Value(noCacheKey{}).(bool); noCache {
+			return false
+		}
+	}
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return false
+	}
+	return true
+}
+
+// pkValue kv（加上defaultWhere）只有一个主键等于的条件时，返回主键的值
+func pkValue(sch *schema.Schema, kv Where, defaultWhere Where) (any, bool) {
+	if len(kv) != 1 || len(defaultWhere) != 0 || sch.PrioritizedPrimaryField == nil {
+		return nil, false
+	}
+	for key, value := range kv {
+		fields := strings.Fields(key)
+		if len(fields) == 2 && fields[1] == "=" {
+			fields = fields[:1]
+		}
+		if len(fields) != 1 || (fields[0] != sch.PrioritizedPrimaryField.DBName && fields[0] != sch.PrioritizedPrimaryField.Name) {
+			return nil, false
+		}
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.String:
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// queryKey 查询条件的hash作为key
+func (c *ModelCache) queryKey(sch *schema.Schema, one bool, kv Where, defaultWhere Where, preloads []string) (string, error) {
+	buf, err := json.Marshal([]any{one, kv, defaultWhere, preloads})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	sum := sha1.Sum(buf)
+	return c.prefix + sch.Table + ":q:" + hex.EncodeToString(sum[:]), nil
+}
+
+// cached 模型注册了缓存时通过缓存读取，没有命中时调用load并写入缓存；缓存出错时直接调用load
+func (o *QuickOrm) cached(one bool, kv Where, out any, preloads []string, load func() (int64, error)) (int64, error) {
+	c := o.cache
+	if c == nil || !c.usable(o.DB) {
+		return load()
+	}
+	sch, err := parseSchema(o.DB, out)
+	if err != nil {
+		return load()
+	}
+	m := c.model(sch.ModelType)
+	if m == nil {
+		return load()
+	}
+
+	var key, pkVersionKey string
+	var tagKeys []string
+	if pk, ok := pkValue(sch, kv, o.defaultWhere); ok && one && len(preloads) == 0 {
+		key, tagKeys, pkVersionKey = c.pkKey(sch, pk), []string{c.pkTagKey(sch)}, c.pkVersionKey(sch, pk)
+	} else if key, err = c.queryKey(sch, one, kv, o.defaultWhere, preloads); err != nil {
+		return load()
+	} else {
+		tagKeys = c.queryTagKeys(sch, m)
+	}
+	return c.remember(key, tagKeys, pkVersionKey, m.ttl, one, out, load)
+}
+
+// remember 读取key的缓存，缓存中记录的tags（以及pkVersionKey，不为空时）的版本与当前版本一致时有效；
+// 版本在读取数据之前获取，所以读取期间有修改时，写入的缓存也是失效的
+func (c *ModelCache) remember(key string, tagKeys []string, pkVersionKey string, ttl time.Duration, one bool, out any, load func() (int64, error)) (int64, error) {
+	versionKeys := tagKeys
+	if pkVersionKey != "" {
+		versionKeys = append(append([]string(nil), tagKeys...), pkVersionKey)
+	}
+	versions := make([]int64, len(versionKeys))
+	kvs, err := c.kv.MGet(append([]string{key}, versionKeys...), nil)
+	if err != nil {
+		c.logger.Errorf("[ORM]read cache %s: %s", key, err.Error())
+		return load()
+	}
+	values := map[string][]byte{}
+	for _, kv := range kvs {
+		values[kv.Key] = kv.Value
+	}
+	for i, versionKey := range versionKeys {
+		if value := values[versionKey]; len(value) > 0 {
+			_ = c.kv.DecoderFunc(value, &versions[i])
+		}
+	}
+
+	if value := values[key]; len(value) > 0 {
+		var entry modelCacheEntry
+		if err = c.kv.DecoderFunc(value, &entry); err == nil && reflect.DeepEqual(entry.Versions, versions) {
+			if err = c.kv.DecoderFunc(entry.Data, out); err == nil {
+				return entry.N, nil
+			}
+		}
+	}
+
+	n, err := load()
+	if err != nil || (one && n == 0) { // 没有找到的不缓存
+		return n, err
+	}
+
+	// 没有版本时只写入版本，下次读取时再缓存。否则版本被清除（或过期）之后，旧的缓存会被认为有效
+	var missing []string
+	for i, version := range versions[:len(tagKeys)] {
+		if version == 0 {
+			missing = append(missing, tagKeys[i])
+		}
+	}
+	if len(missing) > 0 {
+		if err = c.bump(missing...); err != nil {
+			c.logger.Errorf("[ORM]write cache %s: %s", key, err.Error())
+		}
+	}
+	if pkVersionKey != "" && versions[len(versions)-1] == 0 {
+		if err = c.bumpPK(ttl, pkVersionKey); err != nil {
+			c.logger.Errorf("[ORM]write cache %s: %s", key, err.Error())
+		}
+		missing = append(missing, pkVersionKey)
+	}
+	if len(missing) > 0 {
+		return n, nil
+	}
+	data, err := c.kv.EncoderFunc(out)
+	if err == nil {
+		err = c.kv.Set(key, modelCacheEntry{Versions: versions, N: n, Data: data}, ttl)
+	}
+	if err != nil {
+		c.logger.Errorf("[ORM]write cache %s: %s", key, err.Error())
+	}
+	return n, nil
+}
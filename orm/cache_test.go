@@ -0,0 +1,158 @@
+package orm
+
+import (
+	"context"
+	"encoding/json"
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"testing"
+	"time"
+)
+
+// testKV 内存中的 utils.IKV，只实现了 ModelCache 用到的方法
+type testKV struct {
+	utils.IKV
+	data map[string][]byte
+	gets int
+}
+
+func (kv *testKV) MGet(keys []string, actual any) (utils.KVs, error) {
+	kv.gets++
+	var kvs utils.KVs
+	for _, key := range keys {
+		if v, ok := kv.data[key]; ok {
+			kvs = kvs.Append(key, v)
+		}
+	}
+	return kvs, nil
+}
+
+func (kv *testKV) Set(key string, val any, expiration time.Duration) error {
+	buf, err := kv.EncoderFunc(val)
+	kv.data[key] = buf
+	return err
+}
+
+func (kv *testKV) SetNoExpiration(key string, val any) error {
+	return kv.Set(key, val, 0)
+}
+
+func (kv *testKV) Del(key string) error {
+	delete(kv.data, key)
+	return nil
+}
+
+func (kv *testKV) EncoderFunc(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (kv *testKV) DecoderFunc(buf []byte, v any) error {
+	return json.Unmarshal(buf, v)
+}
+
+func TestModelCache(t *testing.T) {
+	kv := &testKV{data: map[string][]byte{}}
+	cache := NewModelCache(kv, zap.NewNop()).Register(&testSite{})
+	o, err := newTestSqlite(t).WithCache(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := &testSite{Name: "a"}
+	if _, err = o.CreateModel(site); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(o *QuickOrm) string {
+		var actual testSite
+		if n, err := o.GetModel(Where{"id": site.ID}, &actual); err != nil || n != 1 {
+			t.Fatalf("get model: %d, %v", n, err)
+		}
+		return actual.Name
+	}
+	// 第一次只写入tag的版本，第二次写入缓存
+	get(o)
+	get(o)
+	if _, ok := kv.data["orm:test_sites:pk:1"]; !ok {
+		t.Fatalf("model is not cached: %v", kv.data)
+	}
+
+	// 绕过gorm修改，缓存不变
+	o.DB.Exec("UPDATE test_sites SET name = 'b'")
+	if name := get(o); name != "a" {
+		t.Errorf("read from cache: %s", name)
+	}
+	bypass, _ := NewQuickOrm(o.DB.WithContext(WithoutCache(context.Background()))).WithCache(cache)
+	if name := get(bypass); name != "b" {
+		t.Errorf("bypass cache: %s", name)
+	}
+	if _, err = o.WithCache(NewModelCache(kv, zap.NewNop())); err == nil {
+		t.Errorf("another ModelCache on the same db: expected error")
+	}
+
+	if _, err = o.UpdateModel(site, KVs{"name": "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if name := get(o); name != "c" {
+		t.Errorf("invalidate by primary key: %s", name)
+	}
+
+	var sites []testSite
+	if _, err = o.GetModels(Where{"name": "c"}, &sites); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = o.UpdateModels(&testSite{}, Where{"name": "c"}, KVs{"name": "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := o.GetModels(Where{"name": "c"}, &sites); n != 0 {
+		t.Errorf("invalidate by tags: %v", sites)
+	}
+	if name := get(o); name != "d" {
+		t.Errorf("invalidate all primary keys: %s", name)
+	}
+}
+
+func TestModelCacheRacingWrite(t *testing.T) {
+	kv := &testKV{data: map[string][]byte{}}
+	cache := NewModelCache(kv, zap.NewNop()).Register(&testSite{})
+	o, err := newTestSqlite(t).WithCache(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site := &testSite{Name: "a"}
+	if _, err = o.CreateModel(site); err != nil {
+		t.Fatal(err)
+	}
+
+	// afterLoad 在读取数据库之后、写入缓存之前执行
+	get := func(afterLoad func()) string {
+		var actual testSite
+		if n, err := o.cached(true, Where{"id": site.ID}, &actual, nil, func() (int64, error) {
+			if err := o.DB.First(&actual, site.ID).Error; err != nil {
+				return 0, err
+			}
+			if afterLoad != nil {
+				afterLoad()
+			}
+			return 1, nil
+		}); err != nil || n != 1 {
+			t.Fatalf("get model: %d, %v", n, err)
+		}
+		return actual.Name
+	}
+	get(nil) // 写入版本
+
+	// 读取到旧数据之后、写入缓存之前，有并发的修改
+	if name := get(func() {
+		if _, err := o.UpdateModel(&testSite{ID: site.ID}, KVs{"name": "b"}); err != nil {
+			t.Fatal(err)
+		}
+	}); name != "a" {
+		t.Fatalf("racing read: %s", name)
+	}
+	if _, ok := kv.data["orm:test_sites:pk:1"]; !ok {
+		t.Fatalf("stale model is not written: %v", kv.data)
+	}
+	if name := get(nil); name != "b" {
+		t.Errorf("stale cache written by a racing read must be invalid: %s", name)
+	}
+}
@@ -3,27 +3,37 @@ package orm
 import (
 	"bytes"
 	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
 	"moul.io/zapgorm2"
+	"net"
+	"strings"
 )
 
-func NewMySqlORM(dbOptions *DBOptions, zapLogger *zap.Logger) (*gorm.DB, error) {
+const (
+	DriverMySql    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+)
+
+// NewORM 按照 dbOptions.Driver 连接数据库，Driver为空时为MySQL，使用 CloseORM 关闭
+func NewORM(dbOptions *DBOptions, zapLogger *zap.Logger) (*gorm.DB, error) {
 	logger := zapgorm2.New(zapLogger)
 	logger = logger.LogMode(gormlogger.Info).(zapgorm2.Logger)
 	logger.SetAsDefault()
 
-	db, err := gorm.Open(mysql.New(mysql.Config{
-		DSN:                       BuildMySqlDSN(dbOptions),
-		DefaultStringSize:         dbOptions.DefaultStringSize,
-		DisableDatetimePrecision:  dbOptions.DisableDatetimePrecision,
-		DefaultDatetimePrecision:  &dbOptions.DefaultDatetimePrecision,
-		DontSupportRenameIndex:    dbOptions.DontSupportRenameIndex,
-		DontSupportRenameColumn:   dbOptions.DontSupportRenameColumn,
-		SkipInitializeWithVersion: dbOptions.SkipInitializeWithVersion,
-	}), &gorm.Config{
+	dialector, err := NewDialector(dbOptions, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
 		SkipDefaultTransaction:                   dbOptions.SkipDefaultTransaction,
 		FullSaveAssociations:                     dbOptions.FullSaveAssociations,
 		Logger:                                   logger,
@@ -51,9 +61,94 @@ func NewMySqlORM(dbOptions *DBOptions, zapLogger *zap.Logger) (*gorm.DB, error)
 	_db.SetConnMaxIdleTime(dbOptions.MaxIdleTime)
 	_db.SetConnMaxLifetime(dbOptions.MaxLifeTime)
 
+	if len(dbOptions.Replicas) > 0 {
+		if err = useReplicas(db, dbOptions, zapLogger); err != nil {
+			return nil, err
+		}
+	}
+
 	return db, err
 }
 
+// CloseORM 关闭 NewORM 创建的db，包括 DBOptions.Replicas 的连接池和健康检查
+func CloseORM(db *gorm.DB) error {
+	var errs error
+	if policy, ok := db.Config.Plugins[replicaPluginName].(*replicaPolicy); ok {
+		errs = policy.Close()
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return multierr.Append(errs, err)
+	}
+	return multierr.Append(errs, errors.WithStack(sqlDB.Close()))
+}
+
+// NewMySqlORM 连接MySQL，忽略 dbOptions.Driver
+func NewMySqlORM(dbOptions *DBOptions, zapLogger *zap.Logger) (*gorm.DB, error) {
+	options := *dbOptions
+	options.Driver = DriverMySql
+	return NewORM(&options, zapLogger)
+}
+
+// NewDialector 按照 dbOptions.Driver 创建gorm的Dialector，conn不为nil时使用已有的连接（忽略DSN）
+func NewDialector(dbOptions *DBOptions, conn gorm.ConnPool) (gorm.Dialector, error) {
+	switch dbOptions.Driver {
+	case "", DriverMySql:
+		config := mysql.Config{
+			DefaultStringSize:         dbOptions.DefaultStringSize,
+			DisableDatetimePrecision:  dbOptions.DisableDatetimePrecision,
+			DefaultDatetimePrecision:  &dbOptions.DefaultDatetimePrecision,
+			DontSupportRenameIndex:    dbOptions.DontSupportRenameIndex,
+			DontSupportRenameColumn:   dbOptions.DontSupportRenameColumn,
+			SkipInitializeWithVersion: dbOptions.SkipInitializeWithVersion,
+		}
+		if conn != nil {
+			config.Conn = conn
+		} else {
+			config.DSN = BuildMySqlDSN(dbOptions)
+		}
+		return mysql.New(config), nil
+	case DriverPostgres:
+		config := postgres.Config{}
+		if conn != nil {
+			config.Conn = conn
+		} else {
+			config.DSN = BuildPostgresDSN(dbOptions)
+		}
+		return postgres.New(config), nil
+	case DriverSqlite:
+		if conn != nil {
+			return &sqlite.Dialector{Conn: conn}, nil
+		}
+		return sqlite.Open(BuildSqliteDSN(dbOptions)), nil
+	}
+	return nil, errors.Errorf("unsupported driver \"%s\"", dbOptions.Driver)
+}
+
+// BuildDSN 按照 dbOptions.Driver 生成DSN
+func BuildDSN(dbOptions *DBOptions) (string, error) {
+	switch dbOptions.Driver {
+	case "", DriverMySql:
+		return BuildMySqlDSN(dbOptions), nil
+	case DriverPostgres:
+		return BuildPostgresDSN(dbOptions), nil
+	case DriverSqlite:
+		return BuildSqliteDSN(dbOptions), nil
+	}
+	return "", errors.Errorf("unsupported driver \"%s\"", dbOptions.Driver)
+}
+
+// sqlDriverName database/sql中注册的驱动名
+func sqlDriverName(driver string) string {
+	switch driver {
+	case DriverPostgres:
+		return "pgx"
+	case DriverSqlite:
+		return "sqlite3"
+	}
+	return "mysql"
+}
+
 // BuildMySqlDSN https://github.com/go-sql-driver/mysql#dsn-data-source-name
 func BuildMySqlDSN(dbOptions *DBOptions) string {
 	dsn := ""
@@ -75,6 +170,7 @@ func BuildMySqlDSN(dbOptions *DBOptions) string {
 	}
 
 	for k, v := range dbOptions.ExtraParams {
+		buffer.WriteString("&")
 		buffer.WriteString(k)
 		buffer.WriteString("=")
 		buffer.WriteString(v)
@@ -83,8 +179,65 @@ func BuildMySqlDSN(dbOptions *DBOptions) string {
 	return buffer.String()
 }
 
+// BuildPostgresDSN https://pkg.go.dev/github.com/jackc/pgx/v5/pgconn#ParseConfig
+//
+//	Address为 host:port，ExtraParams比如 sslmode: disable
+func BuildPostgresDSN(dbOptions *DBOptions) string {
+	host, port, err := net.SplitHostPort(dbOptions.Address)
+	if err != nil { // 没有端口
+		host, port = dbOptions.Address, ""
+	}
+
+	params := []string{"host=" + quotePostgresValue(host)}
+	if port != "" {
+		params = append(params, "port="+quotePostgresValue(port))
+	}
+	params = append(params, "user="+quotePostgresValue(dbOptions.User))
+	if dbOptions.Password != "" {
+		params = append(params, "password="+quotePostgresValue(dbOptions.Password))
+	}
+	params = append(params, "dbname="+quotePostgresValue(dbOptions.DBName))
+	// Local 不是postgres可以识别的时区
+	if dbOptions.TimeZone != "" && dbOptions.TimeZone != "Local" {
+		params = append(params, "TimeZone="+quotePostgresValue(dbOptions.TimeZone))
+	}
+	for k, v := range dbOptions.ExtraParams {
+		params = append(params, k+"="+quotePostgresValue(v))
+	}
+	return strings.Join(params, " ")
+}
+
+var postgresValueEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// quotePostgresValue 值为空或者包含空白、'、\ 时，使用单引号包裹并转义 ' 和 \
+func quotePostgresValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\r\n\f\v'\\") {
+		return value
+	}
+	return "'" + postgresValueEscaper.Replace(value) + "'"
+}
+
+// BuildSqliteDSN DBName为数据库文件的路径（或者 :memory:），ExtraParams比如 _busy_timeout: 5000
+//
+//	https://github.com/mattn/go-sqlite3#connection-string
+func BuildSqliteDSN(dbOptions *DBOptions) string {
+	buffer := bytes.NewBufferString(dbOptions.DBName)
+	sep := "?"
+	if strings.Contains(dbOptions.DBName, "?") {
+		sep = "&"
+	}
+	for k, v := range dbOptions.ExtraParams {
+		buffer.WriteString(sep)
+		buffer.WriteString(k)
+		buffer.WriteString("=")
+		buffer.WriteString(v)
+		sep = "&"
+	}
+	return buffer.String()
+}
+
 func AutoMigrate(dbOptions *DBOptions, zapLogger *zap.Logger, tables ...any) error {
-	db, err := NewMySqlORM(dbOptions, zapLogger)
+	db, err := NewORM(dbOptions, zapLogger)
 	if err != nil {
 		return err
 	}
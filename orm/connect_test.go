@@ -0,0 +1,156 @@
+package orm
+
+import (
+	"encoding/json"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/go-common.v1/orm.v1/types"
+	"gorm.io/gorm"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testSite struct {
+	ID        uint
+	Name      string
+	Domains   types.Domains
+	Ports     types.Int64Slice
+	ExpiredAt types.AnyTime
+}
+
+func newTestSqlite(t *testing.T) *QuickOrm {
+	options := DefaultDBOptions()
+	options.Driver = DriverSqlite
+	options.DBName = t.TempDir() + "/test.db"
+
+	db, err := NewORM(options, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&testSite{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewQuickOrm(db)
+}
+
+func TestSqlite(t *testing.T) {
+	o := newTestSqlite(t)
+	expiredAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	site := &testSite{
+		Name:      "a",
+		Domains:   types.Domains{"a.com", "b.com"},
+		Ports:     types.Int64Slice{80, 443},
+		ExpiredAt: types.AnyTime(expiredAt),
+	}
+	if _, err := o.CreateModel(site); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual testSite
+	if n, err := o.GetModel(Where{"id": site.ID}, &actual); err != nil || n != 1 {
+		t.Fatalf("get model: %d, %v", n, err)
+	}
+	if !reflect.DeepEqual(actual.Domains, site.Domains) || !reflect.DeepEqual(actual.Ports, site.Ports) {
+		t.Errorf("json columns mismatch: %v %v", actual.Domains, actual.Ports)
+	}
+	if !actual.ExpiredAt.ToTime().Equal(expiredAt) {
+		t.Errorf("time column mismatch: %v", actual.ExpiredAt.ToTime())
+	}
+}
+
+func TestBuildDSN(t *testing.T) {
+	options := &DBOptions{Driver: DriverPostgres, Address: "127.0.0.1:5432", User: "root", Password: "pw", DBName: "test", TimeZone: "Asia/Shanghai"}
+	if dsn, _ := BuildDSN(options); dsn != "host=127.0.0.1 port=5432 user=root password=pw dbname=test TimeZone=Asia/Shanghai" {
+		t.Errorf("postgres dsn: %s", dsn)
+	}
+
+	// 包含空格、引号、反斜杠的值需要转义
+	options = &DBOptions{Driver: DriverPostgres, Address: "127.0.0.1", User: "root", Password: `p w'\`, DBName: ""}
+	dsn, _ := BuildDSN(options)
+	if config, err := pgconn.ParseConfig(dsn); err != nil || config.Password != options.Password || config.Host != "127.0.0.1" || config.Database != "" {
+		t.Errorf("postgres dsn: %s, %v", dsn, err)
+	}
+
+	options = &DBOptions{Driver: DriverSqlite, DBName: "/tmp/a.db", ExtraParams: map[string]string{"_busy_timeout": "5000"}}
+	if dsn, _ := BuildDSN(options); dsn != "/tmp/a.db?_busy_timeout=5000" {
+		t.Errorf("sqlite dsn: %s", dsn)
+	}
+
+	if _, err := BuildDSN(&DBOptions{Driver: "oracle"}); err == nil {
+		t.Errorf("unsupported driver must return error")
+	}
+}
+
+func TestAnyTimeDataType(t *testing.T) {
+	for driver, expected := range map[string]string{DriverMySql: "datetime", DriverPostgres: "timestamptz", DriverSqlite: "datetime"} {
+		dialector, err := NewDialector(&DBOptions{Driver: driver, SkipInitializeWithVersion: true}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err = stmt.Parse(&testSite{}); err != nil {
+			t.Fatal(err)
+		}
+		if dataType := db.Migrator().FullDataTypeOf(stmt.Schema.LookUpField("ExpiredAt")).SQL; dataType != expected {
+			t.Errorf("%s: %s, expected %s", driver, dataType, expected)
+		}
+	}
+}
+
+type testSiteSettings struct {
+	Theme string
+	Limit int
+}
+
+type testAccount struct {
+	ID       uint
+	Settings types.JSON[testSiteSettings]
+	Tags     types.StringSlice
+	Roles    types.Set[string]
+	Secret   types.EncryptedString
+	Balance  types.Decimal `gorm:"precision:12;scale:2"`
+	Timeout  types.Duration
+}
+
+func TestTypes(t *testing.T) {
+	if err := types.SetEncryptionKeys([]byte("0123456789abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	o := newTestSqlite(t)
+	if err := o.DB.AutoMigrate(&testAccount{}); err != nil {
+		t.Fatal(err)
+	}
+	account := &testAccount{
+		Settings: types.NewJSON(testSiteSettings{Theme: "dark", Limit: 10}),
+		Tags:     types.StringSlice{"a", "b"},
+		Roles:    types.NewSet("admin", "user", "admin"),
+		Secret:   "password",
+		Balance:  "12345678.90",
+		Timeout:  types.Duration(90 * time.Second),
+	}
+	if _, err := o.CreateModel(account); err != nil {
+		t.Fatal(err)
+	}
+
+	var secret string
+	o.DB.Raw("SELECT secret FROM test_accounts").Scan(&secret)
+	if secret == "" || secret == "password" {
+		t.Errorf("secret is not encrypted: %s", secret)
+	}
+
+	var actual testAccount
+	if n, err := o.GetModel(Where{"id": account.ID}, &actual); err != nil || n != 1 {
+		t.Fatalf("get model: %d, %v", n, err)
+	}
+	if !reflect.DeepEqual(actual, *account) {
+		t.Errorf("columns mismatch: %+v", actual)
+	}
+	if buf, _ := json.Marshal(actual.Timeout); string(buf) != `"1m30s"` {
+		t.Errorf("duration json: %s", buf)
+	}
+}
@@ -0,0 +1,524 @@
+package orm
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration 一个版本的迁移，Up/Down 为Go函数，UpSQL/DownSQL 为SQL，同时存在时先执行SQL
+//
+//	注意：MySQL执行包含多条语句的SQL时，需要在 DBOptions.ExtraParams 中加上 multiStatements: true
+type Migration struct {
+	// Version 版本号，按照从小到大的顺序执行，比如 20240101120000
+	Version int64
+	Name    string
+
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+	UpSQL   string
+	DownSQL string
+
+	// NoTransaction 不在事务中执行，比如 PostgreSQL 的 CREATE INDEX CONCURRENTLY
+	NoTransaction bool
+}
+
+func (m *Migration) run(tx *gorm.DB, up bool) error {
+	sql, fn := m.UpSQL, m.Up
+	if !up {
+		sql, fn = m.DownSQL, m.Down
+	}
+	if sql != "" {
+		if err := tx.Exec(sql).Error; err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if fn != nil {
+		return fn(tx)
+	}
+	return nil
+}
+
+func (m *Migration) reversible() bool {
+	return m.Down != nil || m.DownSQL != ""
+}
+
+// schemaMigration 已执行的迁移记录
+type schemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+// MigrationStatus 迁移的状态，AppliedAt为nil表示未执行
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// Migrator 按版本执行的数据库迁移，已执行的版本记录在 schema_migrations 表中，
+// 执行时会加锁（MySQL: GET_LOCK，PostgreSQL: pg_advisory_lock），多个实例同时启动时不会重复执行
+//
+//	m := orm.NewMigrator(db, zapLogger)
+//	m.Register(&orm.Migration{Version: 20240101120000, Name: "add_users_email", UpSQL: "...", DownSQL: "..."})
+//	m.RegisterFS(migrationsFS, "migrations") // 20240102120000_rename_name.up.sql / 20240102120000_rename_name.down.sql
+//	err := m.Up(ctx, 0)
+type Migrator struct {
+	db     *gorm.DB
+	logger *zap.SugaredLogger
+
+	table       string
+	dryRun      bool
+	out         io.Writer
+	lockTimeout time.Duration
+
+	migrations map[int64]*Migration
+}
+
+type MigratorOption func(m *Migrator)
+
+// WithMigrationTable 记录迁移版本的表名，默认为 schema_migrations，同时也是锁的名称
+func WithMigrationTable(table string) MigratorOption {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// WithMigrationDryRun 只将要执行的SQL输出到out，不会执行，也不会记录版本
+func WithMigrationDryRun(dryRun bool) MigratorOption {
+	return func(m *Migrator) {
+		m.dryRun = dryRun
+	}
+}
+
+// WithMigrationOutput dry-run的SQL以及status的输出，默认为 os.Stdout
+func WithMigrationOutput(out io.Writer) MigratorOption {
+	return func(m *Migrator) {
+		m.out = out
+	}
+}
+
+// WithMigrationLockTimeout 等待其它实例执行迁移的最长时间，默认为10分钟
+func WithMigrationLockTimeout(timeout time.Duration) MigratorOption {
+	return func(m *Migrator) {
+		m.lockTimeout = timeout
+	}
+}
+
+func NewMigrator(db *gorm.DB, zapLogger *zap.Logger, options ...MigratorOption) *Migrator {
+	m := &Migrator{
+		db:          db,
+		logger:      zapLogger.Sugar(),
+		table:       "schema_migrations",
+		out:         os.Stdout,
+		lockTimeout: 10 * time.Minute,
+		migrations:  map[int64]*Migration{},
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// Register 注册迁移，版本号重复时返回错误
+func (m *Migrator) Register(migrations ...*Migration) error {
+	for _, migration := range migrations {
+		if migration.Version <= 0 {
+			return errors.Errorf("invalid version %d of migration \"%s\"", migration.Version, migration.Name)
+		} else if _, ok := m.migrations[migration.Version]; ok {
+			return errors.Errorf("duplicate version %d of migration \"%s\"", migration.Version, migration.Name)
+		}
+		m.migrations[migration.Version] = migration
+	}
+	return nil
+}
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// RegisterFS 注册dir目录中的SQL迁移（一般为embed.FS），文件名为 <version>_<name>.up.sql 和 <version>_<name>.down.sql
+func (m *Migrator) RegisterFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	migrations := map[int64]*Migration{}
+	for _, entry := range entries {
+		matches := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return errors.WithMessagef(err, "migration file \"%s\"", entry.Name())
+		}
+		buf, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		migration, ok := migrations[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			migrations[version] = migration
+		} else if migration.Name != matches[2] {
+			return errors.Errorf("duplicate version %d of migration \"%s\" and \"%s\"", version, migration.Name, matches[2])
+		}
+		if matches[3] == "up" {
+			migration.UpSQL = string(buf)
+		} else {
+			migration.DownSQL = string(buf)
+		}
+	}
+
+	for _, migration := range migrations {
+		if err = m.Register(migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sorted 按版本从小到大排序的所有迁移
+func (m *Migrator) sorted() []*Migration {
+	migrations := make([]*Migration, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+// applied 已执行的版本，表不存在时为空
+func (m *Migrator) applied(db *gorm.DB) (map[int64]*schemaMigration, error) {
+	applied := map[int64]*schemaMigration{}
+	if !db.Migrator().HasTable(m.table) {
+		return applied, nil
+	}
+	var records []*schemaMigration
+	if err := db.Table(m.table).Find(&records).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Status 所有迁移的状态，包括已执行但是没有注册的版本
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(m.primary(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.sorted() {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for version, record := range applied {
+		if _, ok := m.migrations[version]; !ok {
+			statuses = append(statuses, MigrationStatus{Version: version, Name: record.Name, AppliedAt: &record.AppliedAt})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Up 按版本从小到大执行未执行的迁移，steps为最多执行的数量，<=0为全部
+func (m *Migrator) Up(ctx context.Context, steps int) error {
+	return m.locked(ctx, func(db *gorm.DB, applied map[int64]*schemaMigration) error {
+		return m.up(db, applied, steps)
+	})
+}
+
+// Down 按版本从大到小回滚已执行的迁移，steps为回滚的数量，<=0为1
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func(db *gorm.DB, applied map[int64]*schemaMigration) error {
+		return m.down(db, applied, steps)
+	})
+}
+
+// Redo 回滚最后一个已执行的迁移并重新执行
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.locked(ctx, func(db *gorm.DB, applied map[int64]*schemaMigration) error {
+		var last int64
+		for version := range applied {
+			if version > last {
+				last = version
+			}
+		}
+		if last == 0 {
+			return nil
+		}
+		if err := m.down(db, applied, 1); err != nil {
+			return err
+		}
+		delete(applied, last)
+		return m.apply(db, m.migrations[last], true)
+	})
+}
+
+func (m *Migrator) up(db *gorm.DB, applied map[int64]*schemaMigration, steps int) error {
+	n := 0
+	for _, migration := range m.sorted() {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		} else if steps > 0 && n >= steps {
+			break
+		}
+		if err := m.apply(db, migration, true); err != nil {
+			return err
+		}
+		n++
+	}
+	if n == 0 {
+		m.logger.Infof("[ORM]migrate: no pending migrations")
+	}
+	return nil
+}
+
+func (m *Migrator) down(db *gorm.DB, applied map[int64]*schemaMigration, steps int) error {
+	if steps <= 0 {
+		steps = 1
+	}
+	versions := make([]int64, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] > versions[j]
+	})
+	if len(versions) > steps {
+		versions = versions[:steps]
+	}
+
+	for _, version := range versions {
+		migration, ok := m.migrations[version]
+		if !ok {
+			return errors.Errorf("migration %d is applied but not registered", version)
+		} else if !migration.reversible() {
+			return errors.Errorf("migration %d \"%s\" is irreversible", version, migration.Name)
+		}
+		if err := m.apply(db, migration, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply 执行一个迁移并修改版本记录
+func (m *Migrator) apply(db *gorm.DB, migration *Migration, up bool) error {
+	direction := "up"
+	if !up {
+		direction = "down"
+	}
+	if m.dryRun {
+		_, _ = fmt.Fprintf(m.out, "-- %s %d %s\n", direction, migration.Version, migration.Name)
+	}
+
+	now := time.Now()
+	fn := func(tx *gorm.DB) error {
+		if err := migration.run(tx, up); err != nil {
+			return err
+		}
+		if up {
+			return tx.Table(m.table).Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: now}).Error
+		}
+		return tx.Table(m.table).Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error
+	}
+
+	var err error
+	if migration.NoTransaction || m.dryRun {
+		err = fn(db)
+	} else {
+		err = db.Transaction(fn)
+	}
+	if err != nil {
+		return errors.WithMessagef(err, "migrate %s %d \"%s\"", direction, migration.Version, migration.Name)
+	}
+	m.logger.Infof("[ORM]migrate %s %d %s, %0.6f", direction, migration.Version, migration.Name, time.Since(now).Seconds())
+	return nil
+}
+
+// locked 加锁并读取已执行的版本之后调用fn，所有的读写都使用主库；dry-run时不加锁，fn中的db只生成SQL
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB, applied map[int64]*schemaMigration) error) error {
+	if m.dryRun {
+		applied, err := m.applied(m.primary(ctx))
+		if err != nil {
+			return err
+		}
+		return fn(m.primary(ctx).Session(&gorm.Session{DryRun: true, Logger: &dryRunLogger{out: m.out}}), applied)
+	}
+
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// 在锁中创建表、读取版本，其它实例可能已经执行了迁移
+	if err = m.primary(ctx).Table(m.table).AutoMigrate(&schemaMigration{}); err != nil {
+		return errors.WithStack(err)
+	}
+	applied, err := m.applied(m.primary(ctx))
+	if err != nil {
+		return err
+	}
+	return fn(m.primary(ctx), applied)
+}
+
+// primary 使用主库的新会话，Table、Where等条件不会在多次调用之间共享
+func (m *Migrator) primary(ctx context.Context) *gorm.DB {
+	return m.db.Session(&gorm.Session{NewDB: true, Context: ctx}).Clauses(dbresolver.Write).Session(&gorm.Session{})
+}
+
+// lock 在主库的一个独立连接上按数据库类型加锁，连接断开时锁也会释放；SQLite只能单机使用，不加锁
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	var lockSql, unlockSql string
+	var name any = m.table
+	switch m.db.Dialector.Name() {
+	case DriverMySql:
+		// GET_LOCK的超时单位为秒，超时返回0
+		lockSql = fmt.Sprintf("SELECT COALESCE(GET_LOCK(?, %d), 0) = 1", int(m.lockTimeout.Seconds()))
+		unlockSql = "SELECT RELEASE_LOCK(?)"
+	case DriverPostgres:
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(m.table))
+		name = int64(h.Sum64())
+		lockSql, unlockSql = "SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+	default:
+		return func() {}, nil
+	}
+
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	deadline := time.Now().Add(m.lockTimeout)
+	for {
+		var locked bool
+		if err = conn.QueryRowContext(ctx, lockSql, name).Scan(&locked); err != nil {
+			_ = conn.Close()
+			return nil, errors.WithStack(err)
+		} else if locked {
+			break
+		} else if time.Now().After(deadline) {
+			_ = conn.Close()
+			return nil, errors.Errorf("migration lock \"%s\" is not acquired in %s", m.table, m.lockTimeout)
+		}
+		// pg_try_advisory_lock 不会等待
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+
+	return func() {
+		defer conn.Close()
+		if _, err := conn.ExecContext(context.Background(), unlockSql, name); err != nil {
+			m.logger.Errorf("[ORM]release migration lock \"%s\": %s", m.table, err.Error())
+		}
+	}, nil
+}
+
+// Run 按照命令行参数执行，用于在程序中增加迁移的子命令，比如 app migrate up
+//
+//	up [-steps N] [-dry-run]    执行未执行的迁移
+//	down [-steps N] [-dry-run]  回滚，默认回滚1个
+//	redo [-dry-run]             回滚最后一个并重新执行
+//	status                      输出所有迁移的状态
+func (m *Migrator) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing migrate command: up, down, redo, status")
+	}
+
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(m.out)
+	steps := flags.Int("steps", 0, "number of migrations, 0 means all for up and 1 for down")
+	dryRun := flags.Bool("dry-run", m.dryRun, "print SQL without executing")
+	if err := flags.Parse(args[1:]); err != nil {
+		return errors.WithStack(err)
+	}
+
+	migrator := *m
+	migrator.dryRun = *dryRun
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx, *steps)
+	case "down":
+		return migrator.Down(ctx, *steps)
+	case "redo":
+		return migrator.Redo(ctx)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			if _, ok := m.migrations[status.Version]; !ok {
+				appliedAt += " (not registered)"
+			}
+			_, _ = fmt.Fprintf(m.out, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return nil
+	}
+	return errors.Errorf("unknown migrate command \"%s\", must be up, down, redo or status", args[0])
+}
+
+// dryRunLogger 将gorm生成的SQL输出到out
+type dryRunLogger struct {
+	out io.Writer
+}
+
+var _ gormlogger.Interface = (*dryRunLogger)(nil)
+
+func (l *dryRunLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (l *dryRunLogger) Info(context.Context, string, ...any) {}
+
+func (l *dryRunLogger) Warn(context.Context, string, ...any) {}
+
+func (l *dryRunLogger) Error(context.Context, string, ...any) {}
+
+func (l *dryRunLogger) Trace(_ context.Context, _ time.Time, fc func() (sql string, rowsAffected int64), _ error) {
+	sql, _ := fc()
+	_, _ = fmt.Fprintln(l.out, strings.TrimRight(sql, "; \n")+";")
+}
@@ -0,0 +1,102 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrator(t *testing.T) {
+	o := newTestSqlite(t)
+	ctx := context.Background()
+	out := &bytes.Buffer{}
+	m := NewMigrator(o.DB, zap.NewNop(), WithMigrationOutput(out))
+	err := m.Register(&Migration{
+		Version: 1,
+		Name:    "add_sites_owner",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE test_sites ADD COLUMN owner TEXT").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE test_sites DROP COLUMN owner").Error
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.RegisterFS(fstest.MapFS{
+		"migrations/2_create_owners.up.sql":   {Data: []byte("CREATE TABLE owners (id INTEGER PRIMARY KEY)")},
+		"migrations/2_create_owners.down.sql": {Data: []byte("DROP TABLE owners")},
+	}, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Run(ctx, []string{"up", "-dry-run"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "CREATE TABLE owners") || o.DB.Migrator().HasTable("owners") {
+		t.Fatalf("dry run: %s", out.String())
+	}
+
+	if err = m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !o.DB.Migrator().HasColumn(&testSite{}, "owner") || !o.DB.Migrator().HasTable("owners") {
+		t.Fatalf("migrations are not applied")
+	}
+	if err = m.Redo(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].AppliedAt == nil || statuses[1].AppliedAt != nil || o.DB.Migrator().HasTable("owners") {
+		t.Errorf("status after down: %+v", statuses)
+	}
+}
+
+func TestMigratorModel(t *testing.T) {
+	o := newTestSqlite(t)
+	ctx := context.Background()
+	if _, err := o.CreateModel(&testSite{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Go迁移中通过gorm修改model，不能继承版本表的Table
+	m := NewMigrator(o.DB, zap.NewNop())
+	var rowsAffected int64
+	err := m.Register(&Migration{
+		Version: 1,
+		Name:    "rename_sites",
+		Up: func(tx *gorm.DB) error {
+			result := tx.Model(&testSite{}).Where("name = ?", "a").Update("name", "b")
+			rowsAffected = result.RowsAffected
+			return result.Error
+		},
+	}, &Migration{
+		Version:       2,
+		Name:          "rename_sites_again",
+		NoTransaction: true,
+		Up: func(tx *gorm.DB) error {
+			return tx.Model(&testSite{}).Where("name = ?", "b").Update("name", "c").Error
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := o.GetCount(&testSite{}, Where{"name": "c"}); rowsAffected != 1 || n != 1 {
+		t.Errorf("model migration: rows affected %d, count %d", rowsAffected, n)
+	}
+}
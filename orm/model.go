@@ -3,7 +3,6 @@ package orm
 import (
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
-	"strings"
 )
 
 // Where filed: value 快速输入Where条件
@@ -11,16 +10,21 @@ import (
 //	"name": "abc"  => name = 'abc'
 //	"name like ?": "%abc%  => name like '%abc%'
 //	"name in ?": []string{"abc", "cdf"}  => name IN ('abc', 'cdf')
+//	"age >": 18  => age > 18，支持 = != <> > >= < <= in, not in, like, not like, between, not between, is null, is not null
+//	"$or": Or{Where{...}, Where{...}}  => (...) OR (...)
 type Where map[string]any
 type KVs map[string]any
 
 type QuickOrm struct {
 	DB           *gorm.DB
 	defaultWhere Where
+	// versionColumn 乐观锁的版本列，见 UpdateModels
+	versionColumn string
+	cache         *ModelCache
 }
 
 func NewQuickOrm(db *gorm.DB) *QuickOrm {
-	return &QuickOrm{db, Where{}}
+	return &QuickOrm{DB: db, defaultWhere: Where{}}
 }
 
 func (o *QuickOrm) AddDefaultWhere(field string, value any) *QuickOrm {
@@ -28,17 +32,31 @@ func (o *QuickOrm) AddDefaultWhere(field string, value any) *QuickOrm {
 	return o
 }
 
+// SetVersionColumn 按列名识别乐观锁的版本列（比如 version），默认为空，只使用 `gorm:"version"` 标记的字段
+func (o *QuickOrm) SetVersionColumn(column string) *QuickOrm {
+	o.versionColumn = column
+	return o
+}
+
 func (o *QuickOrm) buildWhere(db *gorm.DB, kv Where) *gorm.DB {
+	if len(kv) == 0 {
+		return db
+	}
+	sch := whereSchema(db)
 	for k, v := range kv {
-		if strings.Contains(k, "?") { // 包含 ? 则说明k 是完整的表达式
-			db = db.Where(k, v)
-		} else { // 不然一律按照=处理
-			db = db.Where(k+" = ?", v)
+		query, args, err := o.buildCondition(db, sch, k, v)
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		} else if query != nil {
+			db = db.Where(query, args...)
 		}
 	}
 	return db
 }
 
+// BuildWhere 将 kv 和 defaultWhere 加入db的条件，key的格式见 buildCondition。
+// db有Model时会校验key中的字段，字段或操作符错误会通过 db.Error 返回
 func (o *QuickOrm) BuildWhere(db *gorm.DB, kv Where) *gorm.DB {
 	db = o.buildWhere(db, kv)
 	db = o.buildWhere(db, o.defaultWhere)
@@ -55,35 +73,46 @@ func (o *QuickOrm) Load(models any, loads ...string) (int64, error) {
 	return result.RowsAffected, result.Error
 }
 
-// GetModel 获取第一个Model, 如果没有找到, 不会返回错误, 但是第一个返回参数为0
+// GetModel 获取第一个Model, 如果没有找到, 不会返回错误, 但是第一个返回参数为0。使用了 WithCache 时会先读取缓存
 //
 //	var user = User{}
 //	o.GetModel(Where{"id": 123}, &users) // SELECT * FROM `users` WHERE ID = 123
 func (o *QuickOrm) GetModel(kv Where, out any, preloads ...string) (int64, error) {
-	db := o.DB
-	for _, preload := range preloads {
-		db = db.Preload(preload)
-	}
-	db = o.BuildWhere(db, kv)
-	result := db.First(out)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return 0, nil
-	}
-	return result.RowsAffected, result.Error
+	return o.cached(true, kv, out, preloads, func() (int64, error) {
+		db := o.DB
+		for _, preload := range preloads {
+			db = db.Preload(preload)
+		}
+		db = o.BuildWhere(db.Model(out), kv)
+		result := db.First(out)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return result.RowsAffected, result.Error
+	})
 }
 
-// GetModels 获取符合要求的Models列表
+// GetModels 获取符合要求的Models列表。使用了 WithCache 时会先读取缓存
 //
 //	var users []User
 //	o.GetModel(Where{"id in ?": []int{1, 2}}, &users) // SELECT * FROM `users` WHERE `ID` IN (1, 2)
 func (o *QuickOrm) GetModels(kv Where, out any, preloads ...string) (int64, error) {
-	db := o.DB
-	for _, preload := range preloads {
-		db = db.Preload(preload)
-	}
-	db = o.BuildWhere(db, kv)
-	result := db.Find(out)
-	return result.RowsAffected, result.Error
+	return o.cached(false, kv, out, preloads, func() (int64, error) {
+		db := o.DB
+		for _, preload := range preloads {
+			db = db.Preload(preload)
+		}
+		db = o.BuildWhere(db.Model(out), kv)
+		result := db.Find(out)
+		return result.RowsAffected, result.Error
+	})
+}
+
+// Scopes 返回一个新的QuickOrm，之后的查询都会带上scopes，不会修改原QuickOrm，新的QuickOrm不使用 ModelCache
+//
+//	o.Scopes(query.Scope).GetModels(query.Where, &users)
+func (o *QuickOrm) Scopes(scopes ...func(*gorm.DB) *gorm.DB) *QuickOrm {
+	return &QuickOrm{DB: o.DB.Scopes(scopes...), defaultWhere: o.defaultWhere, versionColumn: o.versionColumn}
 }
 
 func (o *QuickOrm) GetDB() *gorm.DB {
@@ -135,14 +164,37 @@ func (o *QuickOrm) UpdateModel(model any, updateKvs any) (int64, error) {
 //	var user = &User{ID: 1}
 //	o.UpdateModels(user, nil, KVs{"name": "abc"}) // UPDATE `users` SET `name` = 'abc' WHERE `name` = 'abc' AND `id` = 1
 //	o.UpdateModels(&User{}, Where{"name": "abc"}, KVs{"gender": "female"}) // UPDATE `users` SET `gender` = 'female' WHERE `name` = 'abc'
+//
+// model有版本字段（`gorm:"version"` 标记，或者见 SetVersionColumn）时使用乐观锁：
+//
+//	type User struct { ID uint; Name string; Version int64 `gorm:"version"` }
+//	var user = &User{ID: 1, Version: 3}
+//	o.UpdateModel(user, KVs{"name": "abc"}) // UPDATE `users` SET `name` = 'abc', `version` = 4 WHERE `id` = 1 AND `version` = 3
+//
+// 没有修改任何行时返回 *StaleObjectError（errors.Is(err, ErrStaleObject)），成功之后model的版本会加1；
+// model没有主键时（批量修改）只会将版本加1。
+// 只有updateKvs是map或者与model相同类型的struct（只修改非零值的字段），并且没有指定版本的值时才使用乐观锁，否则按原样修改
 func (o *QuickOrm) UpdateModels(model any, kv Where, updateKvs any) (int64, error) {
 	var result *gorm.DB
 	db := o.DB.Model(model)
 	db = o.BuildWhere(db, kv)
 	if _, ok := updateKvs.(KVs); ok { // 将KVs类型强制转换为map[string]any
-		result = db.Updates(map[string]any(updateKvs.(KVs)))
-	} else {
-		result = db.Updates(updateKvs)
+		updateKvs = map[string]any(updateKvs.(KVs))
+	}
+
+	lock, err := o.optimisticLock(db, model)
+	if err != nil {
+		return 0, err
+	} else if lock != nil && !lock.applicable(db, updateKvs) {
+		lock = nil
+	} else if lock != nil {
+		if db, updateKvs, err = lock.apply(db, updateKvs); err != nil {
+			return 0, err
+		}
+	}
+	result = db.Updates(updateKvs)
+	if result.Error == nil && lock != nil {
+		return result.RowsAffected, lock.done(db, result.RowsAffected)
 	}
 	return result.RowsAffected, result.Error
 }
@@ -154,7 +206,7 @@ func (o *QuickOrm) UpdateModels(model any, kv Where, updateKvs any) (int64, erro
 //	o.DeleteModels(&User{}, Where{"name like": "%abc%"}) // DELETE FROM `users` WHERE `name` LIKE '%abc%'
 //	o.DeleteModels([]*User{User{ID: 1}, User{ID: 2}}, Where{"name like": "%abc%"}) // DELETE FROM `users` WHERE `ID` IN (1, 2) AND `name` LIKE '%abc%'
 func (o *QuickOrm) DeleteModels(models any, kv Where) (int64, error) {
-	db := o.DB
+	db := o.DB.Model(models)
 	db = o.BuildWhere(db, kv)
 	result := db.Delete(models)
 	return result.RowsAffected, result.Error
@@ -0,0 +1,190 @@
+package orm
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"gorm.io/plugin/dbresolver"
+	"reflect"
+)
+
+// ErrStaleObject 乐观锁冲突，model已经被其它人修改，使用 errors.Is(err, ErrStaleObject) 判断
+var ErrStaleObject = errors.New("stale object")
+
+// StaleObjectError 乐观锁冲突的详细信息
+type StaleObjectError struct {
+	Table      string
+	PrimaryKey any
+	Version    int64
+}
+
+func (e *StaleObjectError) Error() string {
+	return fmt.Sprintf("stale object: %s %v is not at version %d", e.Table, e.PrimaryKey, e.Version)
+}
+
+func (e *StaleObjectError) Is(target error) bool {
+	return target == ErrStaleObject
+}
+
+type optimisticLock struct {
+	sch   *schema.Schema
+	field *schema.Field
+	// model 有主键时为model的struct，否则为批量修改
+	model   reflect.Value
+	pk      any
+	version int64
+}
+
+// versionField 版本字段：`gorm:"version"` 标记的字段，或者名为column（通过 SetVersionColumn 设置，默认为空）的字段，必须是整数
+func versionField(sch *schema.Schema, column string) *schema.Field {
+	var field *schema.Field
+	for _, f := range sch.Fields {
+		if _, ok := f.TagSettings["VERSION"]; ok {
+			field = f
+			break
+		}
+	}
+	if field == nil && column != "" {
+		field = sch.LookUpField(column)
+	}
+	if field == nil {
+		return nil
+	}
+	switch field.FieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field
+	}
+	return nil
+}
+
+// optimisticLock model有版本字段时返回乐观锁，否则返回nil
+func (o *QuickOrm) optimisticLock(db *gorm.DB, model any) (*optimisticLock, error) {
+	sch, err := parseSchema(db, model)
+	if err != nil { // 无法解析的model由gorm报错
+		return nil, nil
+	}
+	field := versionField(sch, o.versionColumn)
+	if field == nil {
+		return nil, nil
+	}
+
+	lock := &optimisticLock{sch: sch, field: field}
+	rv := reflect.Indirect(reflect.ValueOf(model))
+	if rv.Kind() == reflect.Struct && sch.PrioritizedPrimaryField != nil {
+		ctx := db.Statement.Context
+		if pk, zero := sch.PrioritizedPrimaryField.ValueOf(ctx, rv); !zero {
+			version, _ := field.ValueOf(ctx, rv)
+			lock.model, lock.pk = rv, pk
+			lock.version = reflect.ValueOf(version).Convert(reflect.TypeOf(int64(0))).Int()
+		}
+	}
+	return lock, nil
+}
+
+// applicable updateKvs是map或者与model相同类型的struct，并且没有指定版本的值时才使用乐观锁，否则按原样修改
+func (l *optimisticLock) applicable(db *gorm.DB, updateKvs any) bool {
+	if m, ok := updateKvs.(map[string]any); ok {
+		_, byColumn := m[l.field.DBName]
+		_, byName := m[l.field.Name]
+		return !byColumn && !byName
+	}
+	rv := reflect.Indirect(reflect.ValueOf(updateKvs))
+	if rv.Kind() != reflect.Struct || rv.Type() != l.sch.ModelType {
+		return false
+	}
+	_, zero := l.field.ValueOf(db.Statement.Context, rv)
+	return zero
+}
+
+// apply 加上版本的条件，并将版本加1，只能在 applicable 时调用
+func (l *optimisticLock) apply(db *gorm.DB, updateKvs any) (*gorm.DB, any, error) {
+	column := clause.Column{Table: clause.CurrentTable, Name: l.field.DBName}
+	if !l.model.IsValid() { // 批量修改，只将版本加1
+		updates := l.toMap(db, updateKvs)
+		updates[l.field.DBName] = gorm.Expr("? + 1", column)
+		return db, updates, nil
+	}
+
+	db = db.Where(clause.Eq{Column: column, Value: l.version})
+	if _, ok := updateKvs.(map[string]any); ok {
+		updates := l.toMap(db, updateKvs)
+		updates[l.field.DBName] = l.version + 1
+		return db, updates, nil
+	}
+
+	// 与model相同类型的struct，复制之后修改版本
+	rv := reflect.Indirect(reflect.ValueOf(updateKvs))
+	updates := reflect.New(rv.Type())
+	updates.Elem().Set(rv)
+	if err := l.field.Set(db.Statement.Context, updates.Elem(), l.version+1); err != nil {
+		return db, nil, errors.WithStack(err)
+	}
+	return db, updates.Interface(), nil
+}
+
+// toMap 复制map，或者将与model相同类型的struct转为map。与gorm修改struct相同，只保留非零值的字段
+func (l *optimisticLock) toMap(db *gorm.DB, updateKvs any) map[string]any {
+	if m, ok := updateKvs.(map[string]any); ok {
+		updates := make(map[string]any, len(m)+1)
+		for k, v := range m {
+			updates[k] = v
+		}
+		return updates
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(updateKvs))
+	updates := map[string]any{}
+	for _, field := range l.sch.Fields {
+		if field.DBName == "" || !field.Updatable || field.PrimaryKey || field == l.field {
+			continue
+		}
+		if v, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+			updates[field.DBName] = v
+		}
+	}
+	return updates
+}
+
+// done 没有修改任何行时返回 StaleObjectError，否则将model的版本加1
+func (l *optimisticLock) done(db *gorm.DB, rowsAffected int64) error {
+	if !l.model.IsValid() {
+		return nil
+	} else if rowsAffected == 0 {
+		return errors.WithStack(&StaleObjectError{Table: l.sch.Table, PrimaryKey: l.pk, Version: l.version})
+	}
+	if l.model.CanAddr() {
+		return errors.WithStack(l.field.Set(db.Statement.Context, l.model, l.version+1))
+	}
+	return nil
+}
+
+// RetryUpdate 乐观锁冲突时重试：按主键重新读取model，调用mutate得到需要修改的内容，再使用 UpdateModel 保存，最多执行attempts次
+//
+//	user := &User{ID: 1}
+//	err := o.RetryUpdate(user, 3, func() (any, error) {
+//		return KVs{"balance": user.Balance + 10}, nil
+//	})
+func (o *QuickOrm) RetryUpdate(model any, attempts int, mutate func() (any, error)) error {
+	if attempts <= 0 {
+		attempts = 1
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		// 不使用 GetModel，避免读取到缓存
+		// 强制读取主库，副本的延迟会导致一直冲突
+		if err = o.BuildWhere(o.DB.Clauses(dbresolver.Write).Model(model), nil).First(model).Error; err != nil {
+			return errors.WithStack(err)
+		}
+		var updateKvs any
+		if updateKvs, err = mutate(); err != nil {
+			return err
+		}
+		if _, err = o.UpdateModel(model, updateKvs); !errors.Is(err, ErrStaleObject) {
+			return err
+		}
+	}
+	return err
+}
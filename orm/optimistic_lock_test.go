@@ -0,0 +1,135 @@
+package orm
+
+import (
+	"errors"
+	"testing"
+)
+
+type testWallet struct {
+	ID      uint
+	Balance int64
+	Version int64 `gorm:"version"`
+}
+
+func TestOptimisticLock(t *testing.T) {
+	o := newTestSqlite(t)
+	if err := o.DB.AutoMigrate(&testWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.CreateModel(&testWallet{Balance: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := &testWallet{}, &testWallet{}
+	if err := o.DB.First(a).Error; err != nil {
+		t.Fatal(err)
+	}
+	*b = *a
+
+	if _, err := o.UpdateModel(a, KVs{"balance": a.Balance + 5}); err != nil {
+		t.Fatal(err)
+	} else if a.Version != 1 {
+		t.Errorf("version after update: %d", a.Version)
+	}
+
+	_, err := o.UpdateModel(b, KVs{"balance": b.Balance + 1})
+	var stale *StaleObjectError
+	if !errors.Is(err, ErrStaleObject) || !errors.As(err, &stale) || stale.Version != 0 {
+		t.Fatalf("stale update: %v", err)
+	}
+
+	calls := 0
+	err = o.RetryUpdate(b, 3, func() (any, error) {
+		calls++
+		if calls == 1 { // 模拟并发的修改
+			if _, err := o.UpdateModel(&testWallet{ID: a.ID, Version: a.Version}, KVs{"balance": 100}); err != nil {
+				return nil, err
+			}
+		}
+		return KVs{"balance": b.Balance + 1}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || b.Balance != 101 || b.Version != 3 {
+		t.Errorf("retry: calls %d, balance %d, version %d", calls, b.Balance, b.Version)
+	}
+
+	// 批量修改只将版本加1
+	if _, err = o.UpdateModels(&testWallet{}, Where{"id": a.ID}, KVs{"balance": 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err = o.DB.First(a).Error; err != nil || a.Version != 4 {
+		t.Errorf("bulk update: version %d, %v", a.Version, err)
+	}
+}
+
+func TestOptimisticLockBulkStruct(t *testing.T) {
+	o := newTestSqlite(t)
+	if err := o.DB.AutoMigrate(&testWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	w := &testWallet{Balance: 10}
+	if _, err := o.CreateModel(w); err != nil {
+		t.Fatal(err)
+	}
+
+	// 批量修改时struct也会将版本加1
+	if _, err := o.UpdateModels(&testWallet{}, Where{"id": w.ID}, &testWallet{Balance: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.DB.First(w).Error; err != nil || w.Balance != 20 || w.Version != 1 {
+		t.Errorf("bulk struct update: %+v, %v", w, err)
+	}
+
+	// 其它类型的updateKvs按原样修改，不使用乐观锁
+	if _, err := o.UpdateModels(&testWallet{}, Where{"id": w.ID}, struct{ Balance int64 }{30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.DB.First(w).Error; err != nil || w.Balance != 30 || w.Version != 1 {
+		t.Errorf("other updates type: %+v, %v", w, err)
+	}
+}
+
+// testApp 没有标记 `gorm:"version"` 的version列
+type testApp struct {
+	ID      uint
+	Version int64
+}
+
+func TestOptimisticLockOptIn(t *testing.T) {
+	o := newTestSqlite(t)
+	if err := o.DB.AutoMigrate(&testApp{}, &testWallet{}); err != nil {
+		t.Fatal(err)
+	}
+	app := &testApp{Version: 3}
+	if _, err := o.CreateModel(app); err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认不按列名识别版本，version按原样修改
+	if _, err := o.UpdateModel(&testApp{ID: app.ID}, KVs{"version": 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.DB.First(app).Error; err != nil || app.Version != 7 {
+		t.Errorf("version column without tag: %+v, %v", app, err)
+	}
+
+	// SetVersionColumn 之后按列名使用乐观锁
+	o.SetVersionColumn("version")
+	if _, err := o.UpdateModel(&testApp{ID: app.ID}, KVs{"id": app.ID}); !errors.Is(err, ErrStaleObject) {
+		t.Errorf("SetVersionColumn: expected stale object, got %v", err)
+	}
+
+	// 显式指定版本的值时不使用乐观锁，也不会覆盖
+	w := &testWallet{Balance: 10}
+	if _, err := o.CreateModel(w); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.UpdateModel(&testWallet{ID: w.ID}, KVs{"version": 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.DB.First(w).Error; err != nil || w.Version != 7 {
+		t.Errorf("explicit version: %+v, %v", w, err)
+	}
+}
@@ -6,9 +6,13 @@ import (
 )
 
 type DBOptions struct {
-	Address  string `yaml:"address" validate:"required"`
-	User     string `yaml:"user" validate:"required"`
+	// 数据库驱动：mysql（默认）、postgres、sqlite
+	Driver string `yaml:"driver" validate:"omitempty,oneof=mysql postgres sqlite"`
+	// mysql、postgres为 host:port，sqlite不需要
+	Address  string `yaml:"address" validate:"required_unless=Driver sqlite"`
+	User     string `yaml:"user" validate:"required_unless=Driver sqlite"`
 	Password string `yaml:"password"`
+	// sqlite为数据库文件的路径
 	DBName   string `yaml:"db_name" validate:"required"`
 	Charset  string `yaml:"charset"`
 	TimeZone string `yaml:"time_zone"`
@@ -57,6 +61,24 @@ type DBOptions struct {
 	// 连接生命的最长时间，默认值为0表示不限制
 	// the maximum life-time for a connection, default value is 0 means unlimited
 	MaxLifeTime time.Duration `yaml:"max_life_time"`
+
+	// 只读副本，非事务的读操作会路由到健康的副本，写操作和事务使用主库（Address）
+	Replicas []ReplicaOptions `yaml:"replicas"`
+	// 副本的选择策略：weighted（按权重随机，默认）、round_robin（轮询，忽略权重）
+	ReplicaPolicy string `yaml:"replica_policy"`
+	// 副本健康检查（Ping）的间隔，默认值为10s
+	ReplicaHealthCheckInterval time.Duration `yaml:"replica_health_check_interval"`
+	// 副本连续失败多少次之后剔除，恢复之后自动加入，默认值为3
+	ReplicaMaxFailures int `yaml:"replica_max_failures"`
+}
+
+type ReplicaOptions struct {
+	Address string `yaml:"address" validate:"required"`
+	// 为空时使用主库的 User/Password
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// 权重，默认值为1
+	Weight int `yaml:"weight"`
 }
 
 func DefaultDBOptions() *DBOptions {
@@ -71,5 +93,9 @@ func DefaultDBOptions() *DBOptions {
 		MaxOpenConns: runtime.NumCPU() * 2,
 		MaxIdleTime:  30 * time.Second,  // 30s
 		MaxLifeTime:  300 * time.Second, // 300s
+
+		ReplicaPolicy:              ReplicaPolicyWeighted,
+		ReplicaHealthCheckInterval: 10 * time.Second,
+		ReplicaMaxFailures:         3,
 	}
 }
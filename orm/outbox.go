@@ -0,0 +1,343 @@
+package orm
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"time"
+)
+
+const (
+	OutboxPending int8 = iota
+	OutboxSent
+	OutboxDead
+)
+
+// OutboxMessage outbox表中的事件
+type OutboxMessage struct {
+	ID uint64 `gorm:"primaryKey;index:idx_outbox_status,priority:2"`
+	// AggregateKey 同一个key的事件按照写入的顺序投递，比如 "order:123"，为空时不保证顺序
+	AggregateKey  string `gorm:"size:191;index:idx_outbox_key,priority:1"`
+	Topic         string `gorm:"size:191"`
+	Payload       []byte
+	Status        int8 `gorm:"index:idx_outbox_status,priority:1;index:idx_outbox_key,priority:2"`
+	Attempts      int
+	LastError     string `gorm:"size:1024"`
+	NextAttemptAt time.Time
+	// LockedUntil 被relay领取（投递中）的截止时间，超过之后（比如relay崩溃）可以被重新领取
+	LockedUntil *time.Time
+	SentAt      *time.Time `gorm:"index"`
+	CreatedAt   time.Time
+}
+
+// Outbox 事务性发件箱：在业务修改所在的事务中写入事件，由 OutboxRelay 投递，避免修改之后、发布之前崩溃导致事件丢失
+//
+//	outbox := orm.NewOutbox()
+//	err := db.Transaction(func(tx *gorm.DB) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//		return outbox.Publish(tx, "order.created", fmt.Sprintf("order:%d", order.ID), order)
+//	})
+//	outbox.Notify() // 可选，提交之后立即唤醒relay
+//
+//	relay := outbox.NewRelay(db, orm.NewWebhookSink("https://..."), zapLogger)
+//	go relay.Run(ctx)
+type Outbox struct {
+	table       string
+	encoderFunc textUtils.EncoderFunc
+	notifyCh    chan struct{}
+}
+
+type OutboxOption func(o *Outbox)
+
+// WithOutboxTable outbox的表名，默认为 outbox_messages
+func WithOutboxTable(table string) OutboxOption {
+	return func(o *Outbox) {
+		o.table = table
+	}
+}
+
+// WithOutboxEncoder payload的编码，默认为JSON，[]byte不会编码
+func WithOutboxEncoder(encoderFunc textUtils.EncoderFunc) OutboxOption {
+	return func(o *Outbox) {
+		o.encoderFunc = encoderFunc
+	}
+}
+
+func NewOutbox(options ...OutboxOption) *Outbox {
+	o := &Outbox{
+		table:       "outbox_messages",
+		encoderFunc: textUtils.JsonMarshalToBytes,
+		notifyCh:    make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// AutoMigrate 创建（或者更新）outbox表
+func (o *Outbox) AutoMigrate(db *gorm.DB) error {
+	return errors.WithStack(db.Table(o.table).AutoMigrate(&OutboxMessage{}))
+}
+
+// Publish 写入一个事件，tx必须是业务修改所在的事务，事务回滚时事件也不会被投递
+func (o *Outbox) Publish(tx *gorm.DB, topic, aggregateKey string, payload any) error {
+	buf, ok := payload.([]byte)
+	if !ok {
+		var err error
+		if buf, err = o.encoderFunc(payload); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	now := time.Now()
+	message := &OutboxMessage{
+		AggregateKey:  aggregateKey,
+		Topic:         topic,
+		Payload:       buf,
+		Status:        OutboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	return errors.WithStack(tx.Table(o.table).Create(message).Error)
+}
+
+// Notify 唤醒relay立即投递，需要在事务提交之后调用；不调用时relay按轮询间隔投递
+func (o *Outbox) Notify() {
+	select {
+	case o.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// OutboxSink 事件的投递目标，返回错误时按照退避策略重试
+type OutboxSink interface {
+	Send(ctx context.Context, message *OutboxMessage) error
+}
+
+type OutboxSinkFunc func(ctx context.Context, message *OutboxMessage) error
+
+func (fn OutboxSinkFunc) Send(ctx context.Context, message *OutboxMessage) error {
+	return fn(ctx, message)
+}
+
+// OutboxRelay 轮询outbox表并投递到sink。
+//
+// 每一轮在一个短事务中领取每个key最早的未投递事件（到了重试时间的），并写入 LockedUntil，
+// 之后在事务之外投递，每个事件的结果单独保存。同一个key在前一个事件投递成功（或者dead）之前，之后的事件不会被领取，
+// 所以多个实例同时运行时也能保证同一个key的顺序；一个key在等待重试时也不会影响其它key
+type OutboxRelay struct {
+	outbox *Outbox
+	db     *gorm.DB
+	sink   OutboxSink
+	logger *zap.SugaredLogger
+
+	batchSize       int
+	pollInterval    time.Duration
+	sendTimeout     time.Duration
+	maxAttempts     int
+	backoffBase     time.Duration
+	backoffMax      time.Duration
+	retention       time.Duration
+	cleanupInterval time.Duration
+}
+
+type OutboxRelayOption func(r *OutboxRelay)
+
+// WithRelayBatchSize 每一轮最多读取的事件数，默认100
+func WithRelayBatchSize(batchSize int) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.batchSize = batchSize
+	}
+}
+
+// WithRelayPollInterval 没有事件时的轮询间隔，默认1s
+func WithRelayPollInterval(interval time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.pollInterval = interval
+	}
+}
+
+// WithRelaySendTimeout 投递一个事件的超时，默认10s。一轮领取的事件依次投递，领取的时限为 sendTimeout*(事件数+1)
+func WithRelaySendTimeout(timeout time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.sendTimeout = timeout
+	}
+}
+
+// WithRelayMaxAttempts 最多投递的次数，超过之后标记为dead，不再阻塞同一个key之后的事件，默认10
+func WithRelayMaxAttempts(maxAttempts int) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.maxAttempts = maxAttempts
+	}
+}
+
+// WithRelayBackoff 重试的指数退避：第n次失败之后等待 base*2^(n-1)，最长max，默认1s~5m
+func WithRelayBackoff(base, max time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.backoffBase = base
+		r.backoffMax = max
+	}
+}
+
+// WithRelayCleanup 每隔interval删除投递成功超过retention的事件，默认每1小时删除7天前的，retention为0不删除
+func WithRelayCleanup(retention, interval time.Duration) OutboxRelayOption {
+	return func(r *OutboxRelay) {
+		r.retention = retention
+		r.cleanupInterval = interval
+	}
+}
+
+func (o *Outbox) NewRelay(db *gorm.DB, sink OutboxSink, zapLogger *zap.Logger, options ...OutboxRelayOption) *OutboxRelay {
+	r := &OutboxRelay{
+		outbox:          o,
+		db:              db,
+		sink:            sink,
+		logger:          zapLogger.Sugar(),
+		batchSize:       100,
+		pollInterval:    time.Second,
+		sendTimeout:     10 * time.Second,
+		maxAttempts:     10,
+		backoffBase:     time.Second,
+		backoffMax:      5 * time.Minute,
+		retention:       7 * 24 * time.Hour,
+		cleanupInterval: time.Hour,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// backoff 第attempts次失败之后的等待时间
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	d := float64(r.backoffBase) * math.Pow(2, float64(attempts-1))
+	if d > float64(r.backoffMax) {
+		return r.backoffMax
+	}
+	return time.Duration(d)
+}
+
+// Run 阻塞的投递事件，直到ctx结束
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	lastCleanup := time.Now()
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil {
+			r.logger.Errorf("[ORM]outbox relay error: %s", err.Error())
+		}
+
+		if r.retention > 0 && time.Since(lastCleanup) >= r.cleanupInterval {
+			lastCleanup = time.Now()
+			if _, err = r.Cleanup(ctx); err != nil {
+				r.logger.Errorf("[ORM]outbox cleanup error: %s", err.Error())
+			}
+		}
+
+		if n > 0 && err == nil { // 可能还有更多的事件
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.outbox.notifyCh:
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// RelayOnce 投递一轮事件，返回投递成功的数量
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	messages, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs error
+	for _, message := range messages {
+		if ctx.Err() != nil { // 停止时未投递的事件等领取过期之后再投递
+			break
+		}
+		attempts := message.Attempts
+		updates := map[string]any{"locked_until": nil}
+		if err = r.send(ctx, message); err == nil {
+			sent++
+			updates["status"], updates["sent_at"] = OutboxSent, time.Now()
+		} else if ctx.Err() == nil {
+			message.Attempts++
+			message.LastError = err.Error()
+			if len(message.LastError) > 1024 {
+				message.LastError = message.LastError[:1024]
+			}
+			updates["attempts"], updates["last_error"] = message.Attempts, message.LastError
+			if r.maxAttempts > 0 && message.Attempts >= r.maxAttempts {
+				updates["status"] = OutboxDead
+				r.logger.Errorf("[ORM]outbox message %d(%s) dead after %d attempts: %s", message.ID, message.Topic, message.Attempts, err.Error())
+			} else {
+				message.NextAttemptAt = time.Now().Add(r.backoff(message.Attempts))
+				updates["next_attempt_at"] = message.NextAttemptAt
+				r.logger.Warnf("[ORM]outbox message %d(%s) failed, retry at %s: %s", message.ID, message.Topic, message.NextAttemptAt.Format(time.RFC3339), err.Error())
+			}
+		} // 停止时被取消的投递，只释放领取，不计入失败的次数
+
+		// 不使用ctx，停止时也要保存已经投递的结果。只修改仍然是领取时状态的事件，避免覆盖领取过期之后被其它relay投递的结果
+		err = r.db.Table(r.outbox.table).
+			Where("id = ? AND status = ? AND attempts = ?", message.ID, OutboxPending, attempts).
+			Updates(updates).Error
+		if err != nil {
+			errs = multierr.Append(errs, errors.WithMessagef(err, "update outbox message %d", message.ID))
+		}
+	}
+	return sent, errs
+}
+
+// claim 在短事务中领取每个key最早的、到了重试时间的未投递事件，AggregateKey为空的事件都可以被领取
+func (r *OutboxRelay) claim(ctx context.Context) ([]*OutboxMessage, error) {
+	var messages []*OutboxMessage
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Table(r.outbox.table).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("status = ? AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until <= ?)", OutboxPending, now, now).
+			Where("(aggregate_key = '' OR id = (SELECT MIN(head.id) FROM ? AS head WHERE head.aggregate_key = ? AND head.status = ?))",
+				clause.Table{Name: r.outbox.table}, clause.Column{Table: r.outbox.table, Name: "aggregate_key"}, OutboxPending).
+			Order("id").Limit(r.batchSize).Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return errors.WithStack(err)
+		}
+
+		ids := make([]uint64, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+		}
+		lockedUntil := now.Add(r.sendTimeout * time.Duration(len(messages)+1))
+		return errors.WithStack(tx.Table(r.outbox.table).Where("id IN ?", ids).Update("locked_until", lockedUntil).Error)
+	})
+	return messages, err
+}
+
+func (r *OutboxRelay) send(ctx context.Context, message *OutboxMessage) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = errors.Errorf("panic: %v", e)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, r.sendTimeout)
+	defer cancel()
+	return r.sink.Send(ctx, message)
+}
+
+// Cleanup 删除投递成功超过retention的事件，dead的事件不会被删除
+func (r *OutboxRelay) Cleanup(ctx context.Context) (int64, error) {
+	result := r.db.WithContext(ctx).Table(r.outbox.table).
+		Where("status = ? AND sent_at < ?", OutboxSent, time.Now().Add(-r.retention)).
+		Delete(&OutboxMessage{})
+	return result.RowsAffected, errors.WithStack(result.Error)
+}
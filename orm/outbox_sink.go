@@ -0,0 +1,156 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-mixed/go-common.v1/utils/http"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// outboxEmitter event.Emitter（github.com/olebedev/emitter）满足此接口
+type outboxEmitter interface {
+	Emit(topic string, args ...any) chan struct{}
+}
+
+// NewEmitterSink 投递到进程内的 event.Emitter，topic为事件的Topic，参数为 *OutboxMessage，等待所有的listener收到之后返回
+func NewEmitterSink(emitter outboxEmitter) OutboxSink {
+	return OutboxSinkFunc(func(ctx context.Context, message *OutboxMessage) error {
+		select {
+		case <-emitter.Emit(message.Topic, message):
+			return nil
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+	})
+}
+
+// NewRedisStreamSink 使用XADD投递到Redis Stream，stream为空时使用事件的Topic；maxLen>0时近似的裁剪stream的长度。
+// client可以是 redis.Redis 的 RedisClient
+//
+//	字段为 id、topic、aggregate_key、payload、created_at
+func NewRedisStreamSink(client redis.Cmdable, stream string, maxLen int64) OutboxSink {
+	return OutboxSinkFunc(func(ctx context.Context, message *OutboxMessage) error {
+		args := &redis.XAddArgs{
+			Stream: stream,
+			MaxLen: maxLen,
+			Approx: maxLen > 0,
+			Values: map[string]any{
+				"id":            message.ID,
+				"topic":         message.Topic,
+				"aggregate_key": message.AggregateKey,
+				"payload":       message.Payload,
+				"created_at":    message.CreatedAt.UnixMilli(),
+			},
+		}
+		if args.Stream == "" {
+			args.Stream = message.Topic
+		}
+		return errors.WithStack(client.XAdd(ctx, args).Err())
+	})
+}
+
+// WebhookSink 使用HTTP POST投递，body为JSON，非2xx的响应视为失败
+type WebhookSink struct {
+	url     string
+	secret  []byte
+	headers map[string]string
+	client  *http.Client
+}
+
+type WebhookSinkOption func(s *WebhookSink)
+
+// WithWebhookSecret 使用secret对body进行HMAC-SHA256签名，hex之后放在 X-Outbox-Signature 中
+func WithWebhookSecret(secret string) WebhookSinkOption {
+	return func(s *WebhookSink) {
+		s.secret = []byte(secret)
+	}
+}
+
+// WithWebhookHeaders 额外的请求头，比如 Authorization
+func WithWebhookHeaders(headers map[string]string) WebhookSinkOption {
+	return func(s *WebhookSink) {
+		s.headers = headers
+	}
+}
+
+// WithWebhookClient 自定义的http.Client，默认超时10s
+func WithWebhookClient(client *http.Client) WebhookSinkOption {
+	return func(s *WebhookSink) {
+		s.client = client
+	}
+}
+
+var _ OutboxSink = (*WebhookSink)(nil)
+
+func NewWebhookSink(url string, options ...WebhookSinkOption) *WebhookSink {
+	s := &WebhookSink{
+		url:    url,
+		client: httpUtils.DefaultHttpClient(10 * time.Second),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+type webhookBody struct {
+	ID           uint64    `json:"id"`
+	Topic        string    `json:"topic"`
+	AggregateKey string    `json:"aggregate_key"`
+	Payload      any       `json:"payload"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (s *WebhookSink) Send(ctx context.Context, message *OutboxMessage) error {
+	body := webhookBody{
+		ID:           message.ID,
+		Topic:        message.Topic,
+		AggregateKey: message.AggregateKey,
+		Payload:      string(message.Payload),
+		CreatedAt:    message.CreatedAt,
+	}
+	if json.Valid(message.Payload) {
+		body.Payload = json.RawMessage(message.Payload)
+	}
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(buf))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Outbox-Id", strconv.FormatUint(message.ID, 10))
+	req.Header.Set("X-Outbox-Topic", message.Topic)
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(buf)
+		req.Header.Set("X-Outbox-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return errors.Errorf("webhook %s responded %d: %s", s.url, resp.StatusCode, string(respBody))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
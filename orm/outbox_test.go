@@ -0,0 +1,113 @@
+package orm
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	o := newTestSqlite(t)
+	outbox := NewOutbox()
+	if err := outbox.AutoMigrate(o.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	publish := func(topic, key string, rollback bool) {
+		err := o.DB.Transaction(func(tx *gorm.DB) error {
+			if err := outbox.Publish(tx, topic, key, map[string]any{"topic": topic}); err != nil {
+				return err
+			}
+			if rollback {
+				return errors.New("rollback")
+			}
+			return nil
+		})
+		if err != nil && !rollback {
+			t.Fatal(err)
+		}
+	}
+	publish("a1", "a", false)
+	publish("a2", "a", false)
+	publish("b1", "b", false)
+	publish("c1", "c", true)
+
+	var sent []string
+	failed := map[string]bool{"a1": true}
+	relay := outbox.NewRelay(o.DB, OutboxSinkFunc(func(ctx context.Context, message *OutboxMessage) error {
+		if failed[message.Topic] {
+			delete(failed, message.Topic)
+			return errors.New("unavailable")
+		}
+		sent = append(sent, message.Topic)
+		return nil
+	}), zap.NewNop(), WithRelayBackoff(time.Millisecond, time.Millisecond))
+
+	// a1失败之后，a2需要等待a1
+	if _, err := relay.RelayOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sent, []string{"b1"}) {
+		t.Fatalf("first round: %v", sent)
+	}
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if _, err := relay.RelayOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(sent, []string{"b1", "a1", "a2"}) {
+		t.Errorf("second round: %v", sent)
+	}
+}
+
+func TestOutboxRelayClaim(t *testing.T) {
+	o := newTestSqlite(t)
+	outbox := NewOutbox()
+	if err := outbox.AutoMigrate(o.DB); err != nil {
+		t.Fatal(err)
+	}
+	for _, topic := range []string{"a1", "a2", "a3", "b1"} {
+		if err := outbox.Publish(o.DB, topic, topic[:1], nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var relay *OutboxRelay
+	var sent []string
+	relay = outbox.NewRelay(o.DB, OutboxSinkFunc(func(ctx context.Context, message *OutboxMessage) error {
+		if message.Topic == "a1" {
+			return errors.New("unavailable")
+		}
+		// 投递在事务之外，投递中的事件已被领取，不会被其它relay重复投递
+		if n, err := relay.RelayOnce(ctx); err != nil || n != 0 {
+			t.Errorf("nested relay: %d, %v", n, err)
+		}
+		sent = append(sent, message.Topic)
+		if message.Topic == "b1" { // 投递时没有持有outbox表的锁，可以写入新的事件
+			return outbox.Publish(o.DB, "c1", "c", nil)
+		}
+		return nil
+	}), zap.NewNop(), WithRelayBatchSize(1), WithRelayBackoff(time.Hour, time.Hour))
+
+	// 每个key只读取最早的事件，a1等待重试时不会阻塞b1
+	for i := 0; i < 3; i++ {
+		if _, err := relay.RelayOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(sent, []string{"b1", "c1"}) {
+		t.Errorf("sent: %v", sent)
+	}
+
+	var message OutboxMessage
+	if err := o.DB.Table(outbox.table).Where("topic = ?", "a1").First(&message).Error; err != nil {
+		t.Fatal(err)
+	} else if message.Attempts != 1 || message.LockedUntil != nil || !message.NextAttemptAt.After(time.Now()) {
+		t.Errorf("failed message: %+v", message)
+	}
+}
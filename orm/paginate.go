@@ -0,0 +1,276 @@
+package orm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"gorm.io/gorm"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Pagination 按页码分页的结果
+type Pagination struct {
+	Total    int64 `json:"total"`
+	Page     int   `json:"page"`
+	PageSize int   `json:"page_size"`
+	Pages    int   `json:"pages"`
+	Items    any   `json:"items"`
+}
+
+// CursorPagination 按游标（keyset）分页的结果，NextCursor/PrevCursor 为空表示没有下一页/上一页
+type CursorPagination struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+	Items      any    `json:"items"`
+}
+
+// MaxPageSize Paginate 的pageSize、KeysetPaginate 的limit的最大值，超过之后使用最大值
+var MaxPageSize = 1000
+
+// Paginate 按页码分页，page从1开始，out为slice的指针，orderBy比如 "id desc"
+//
+//	page、pageSize通常来自客户端，pageSize<1时返回 *QueryError，超出范围的page返回空的Items
+//
+//	var users []User
+//	p, err := o.Paginate(Where{"status": 1}, 2, 20, &users, "id desc") // p.Items == &users
+func (o *QuickOrm) Paginate(kv Where, page, pageSize int, out any, orderBy ...string) (*Pagination, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		return nil, newQueryError("page size must be > 0")
+	} else if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	model := reflect.New(sliceElemType(out)).Interface()
+	total, err := o.GetCount(model, kv)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	p := &Pagination{
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+		Pages:    int((total + int64(pageSize) - 1) / int64(pageSize)),
+		Items:    out,
+	}
+	if page > p.Pages { // 超出范围，不需要查询；比较页数而不是offset，避免很大的page溢出
+		return p, nil
+	}
+
+	db := o.BuildWhere(o.DB.Model(out), kv)
+	for _, order := range orderBy {
+		db = db.Order(order)
+	}
+	if err = db.Offset((page - 1) * pageSize).Limit(pageSize).Find(out).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return p, nil
+}
+
+type keysetOrder struct {
+	column string
+	desc   bool
+}
+
+type keysetCursor struct {
+	Prev   bool              `json:"p,omitempty"`
+	Values []json.RawMessage `json:"v"`
+}
+
+var keysetColumnRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+func parseKeysetOrders(orderBy []string) ([]keysetOrder, error) {
+	if len(orderBy) == 0 {
+		return nil, errors.Errorf("order by of keyset pagination must not be empty")
+	}
+	orders := make([]keysetOrder, 0, len(orderBy))
+	for _, order := range orderBy {
+		fields := strings.Fields(order)
+		if len(fields) == 0 || len(fields) > 2 || !keysetColumnRegexp.MatchString(fields[0]) {
+			return nil, errors.Errorf("invalid order by \"%s\"", order)
+		}
+		o := keysetOrder{column: fields[0]}
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				o.desc = true
+			default:
+				return nil, errors.Errorf("invalid order by \"%s\"", order)
+			}
+		}
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
+
+// KeysetPaginate 按游标分页，比 Paginate 更适合翻很多页的场景
+//
+//	orderBy 为排序的列，最后一列必须是唯一的（比如主键），比如 []string{"created_at desc", "id desc"}
+//	cursor 为上次返回的 NextCursor 或 PrevCursor，为空表示第一页，无效的cursor返回 *QueryError
+//	out 为slice的指针，返回的 Items 就是 out
+//
+//	p, err := o.KeysetPaginate(Where{"status": 1}, []string{"id desc"}, ctx.Query("cursor"), 20, &users)
+func (o *QuickOrm) KeysetPaginate(kv Where, orderBy []string, cursor string, limit int, out any) (*CursorPagination, error) {
+	if limit < 1 {
+		return nil, newQueryError("limit must be > 0")
+	} else if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	orders, err := parseKeysetOrders(orderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &gorm.Statement{DB: o.DB}
+	if err = stmt.Parse(reflect.New(sliceElemType(out)).Interface()); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	fieldTypes := make([]reflect.Type, len(orders))
+	for i, order := range orders {
+		column := order.column[strings.LastIndex(order.column, ".")+1:]
+		field := stmt.Schema.LookUpField(column)
+		if field == nil {
+			return nil, errors.Errorf("order by column \"%s\" is not a field of %s", order.column, stmt.Schema.Name)
+		}
+		fieldTypes[i] = field.FieldType
+	}
+
+	var c keysetCursor
+	if cursor != "" {
+		if c, err = decodeKeysetCursor(cursor, len(orders)); err != nil {
+			return nil, err
+		}
+	}
+
+	db := o.BuildWhere(o.DB.Model(out), kv)
+	if len(c.Values) > 0 {
+		expr, args, err := keysetWhere(orders, fieldTypes, c)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(expr, args...)
+	}
+	for _, order := range orders {
+		// 向前翻页时反向排序，查询之后再翻转
+		if order.desc != c.Prev {
+			db = db.Order(order.column + " DESC")
+		} else {
+			db = db.Order(order.column + " ASC")
+		}
+	}
+	// 多查一条用于判断是否还有更多
+	if err = db.Limit(limit + 1).Find(out).Error; err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	rows := reflect.ValueOf(out).Elem()
+	hasMore := rows.Len() > limit
+	if hasMore {
+		rows.Set(rows.Slice(0, limit))
+	}
+	if c.Prev {
+		swap := reflect.Swapper(rows.Interface())
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	p := &CursorPagination{Limit: limit, Items: out}
+	if rows.Len() == 0 {
+		return p, nil
+	}
+	// 向后翻页时，有更多才有下一页，有游标就有上一页；向前翻页相反
+	hasNext, hasPrev := hasMore, cursor != ""
+	if c.Prev {
+		hasNext, hasPrev = true, hasMore
+	}
+	if hasNext {
+		if p.NextCursor, err = encodeKeysetCursor(stmt, orders, rows.Index(rows.Len()-1), false); err != nil {
+			return nil, err
+		}
+	}
+	if hasPrev {
+		if p.PrevCursor, err = encodeKeysetCursor(stmt, orders, rows.Index(0), true); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// keysetWhere 生成 (a > ?) OR (a = ? AND b > ?) ...
+func keysetWhere(orders []keysetOrder, fieldTypes []reflect.Type, c keysetCursor) (string, []any, error) {
+	values := make([]any, len(orders))
+	for i, raw := range c.Values {
+		v := reflect.New(fieldTypes[i])
+		if err := textUtils.JsonUnmarshalFromBytes(raw, v.Interface()); err != nil {
+			return "", nil, newQueryError("invalid cursor value of \"%s\"", orders[i].column)
+		}
+		values[i] = v.Elem().Interface()
+	}
+
+	var ors []string
+	var args []any
+	for i, order := range orders {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, orders[j].column+" = ?")
+			args = append(args, values[j])
+		}
+		if order.desc != c.Prev {
+			ands = append(ands, order.column+" < ?")
+		} else {
+			ands = append(ands, order.column+" > ?")
+		}
+		args = append(args, values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return strings.Join(ors, " OR "), args, nil
+}
+
+func encodeKeysetCursor(stmt *gorm.Statement, orders []keysetOrder, row reflect.Value, prev bool) (string, error) {
+	c := keysetCursor{Prev: prev}
+	for _, order := range orders {
+		field := stmt.Schema.LookUpField(order.column[strings.LastIndex(order.column, ".")+1:])
+		value, _ := field.ValueOf(context.Background(), reflect.Indirect(row))
+		buf, err := textUtils.JsonMarshalToBytes(value)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, buf)
+	}
+	buf, err := textUtils.JsonMarshalToBytes(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func decodeKeysetCursor(cursor string, columns int) (keysetCursor, error) {
+	var c keysetCursor
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, newQueryError("invalid cursor \"%s\"", cursor)
+	}
+	if err = textUtils.JsonUnmarshalFromBytes(buf, &c); err != nil || len(c.Values) != columns {
+		return c, newQueryError("invalid cursor \"%s\"", cursor)
+	}
+	return c, nil
+}
+
+// sliceElemType 返回 *[]T 或 *[]*T 的 T
+func sliceElemType(out any) reflect.Type {
+	t := reflect.TypeOf(out)
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,98 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func siteNames(sites []testSite) []string {
+	names := make([]string, 0, len(sites))
+	for _, site := range sites {
+		names = append(names, site.Name)
+	}
+	return names
+}
+
+func TestPaginate(t *testing.T) {
+	o := newTestSqlite(t)
+	for i := 1; i <= 5; i++ {
+		if _, err := o.CreateModel(&testSite{Name: fmt.Sprintf("s%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var sites []testSite
+	p, err := o.Paginate(nil, 2, 2, &sites, "id desc")
+	if err != nil {
+		t.Fatal(err)
+	} else if p.Total != 5 || p.Pages != 3 || fmt.Sprint(siteNames(sites)) != "[s3 s2]" {
+		t.Errorf("page 2: %+v %v", p, siteNames(sites))
+	}
+
+	// 超出范围的page不会溢出，返回空的Items
+	sites = nil
+	if p, err = o.Paginate(nil, math.MaxInt, 2, &sites, "id desc"); err != nil || len(sites) != 0 || p.Total != 5 {
+		t.Errorf("out of range: %+v %v %v", p, sites, err)
+	}
+	if p, err = o.Paginate(nil, 1, math.MaxInt, &sites, "id desc"); err != nil || p.PageSize != MaxPageSize || len(sites) != 5 {
+		t.Errorf("max page size: %+v %v", p, err)
+	}
+
+	var queryErr *QueryError
+	if _, err = o.Paginate(nil, 1, 0, &sites); !errors.As(err, &queryErr) {
+		t.Errorf("page size 0: expected QueryError, got %v", err)
+	}
+}
+
+func TestKeysetPaginate(t *testing.T) {
+	o := newTestSqlite(t)
+	for i := 1; i <= 5; i++ {
+		if _, err := o.CreateModel(&testSite{Name: fmt.Sprintf("s%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	orderBy := []string{"id desc"}
+
+	page := func(cursor string) (*CursorPagination, []string) {
+		t.Helper()
+		var sites []testSite
+		p, err := o.KeysetPaginate(nil, orderBy, cursor, 2, &sites)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p, siteNames(sites)
+	}
+
+	p1, names := page("")
+	if fmt.Sprint(names) != "[s5 s4]" || p1.NextCursor == "" || p1.PrevCursor != "" {
+		t.Fatalf("first page: %+v %v", p1, names)
+	}
+	p2, names := page(p1.NextCursor)
+	if fmt.Sprint(names) != "[s3 s2]" || p2.NextCursor == "" || p2.PrevCursor == "" {
+		t.Fatalf("second page: %+v %v", p2, names)
+	}
+	p3, names := page(p2.NextCursor)
+	if fmt.Sprint(names) != "[s1]" || p3.NextCursor != "" || p3.PrevCursor == "" {
+		t.Fatalf("last page: %+v %v", p3, names)
+	}
+	// 向前翻页
+	back, names := page(p3.PrevCursor)
+	if fmt.Sprint(names) != "[s3 s2]" || back.NextCursor == "" || back.PrevCursor == "" {
+		t.Errorf("previous page: %+v %v", back, names)
+	}
+	if back, names = page(back.PrevCursor); fmt.Sprint(names) != "[s5 s4]" || back.PrevCursor != "" {
+		t.Errorf("first page again: %+v %v", back, names)
+	}
+
+	// 篡改的cursor返回400
+	for _, cursor := range []string{"!!!", "e30", "eyJ2IjpbImEiXX0", p1.NextCursor + "x"} {
+		var sites []testSite
+		_, err := o.KeysetPaginate(nil, orderBy, cursor, 2, &sites)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) || queryErr.GetStatusCode() != 400 {
+			t.Errorf("cursor %q: expected QueryError, got %v", cursor, err)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package orm
+
+import (
+	"fmt"
+	"gopkg.in/go-mixed/go-common.v1/utils/time"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type QueryFieldType int
+
+const (
+	QueryString QueryFieldType = iota
+	QueryInt
+	QueryFloat
+	QueryBool
+	QueryTime
+)
+
+// 各类型默认允许的操作符
+var queryTypeOperators = map[QueryFieldType][]string{
+	QueryString: {"eq", "ne", "in", "nin", "like", "null"},
+	QueryInt:    {"eq", "ne", "gt", "gte", "lt", "lte", "in", "nin", "null"},
+	QueryFloat:  {"eq", "ne", "gt", "gte", "lt", "lte", "in", "nin", "null"},
+	QueryBool:   {"eq", "ne", "null"},
+	QueryTime:   {"eq", "ne", "gt", "gte", "lt", "lte", "null"},
+}
+
+// 查询参数中的操作符 => Where key中的操作符
+var queryOperators = map[string]string{
+	"eq":   "=",
+	"ne":   "!=",
+	"gt":   ">",
+	"gte":  ">=",
+	"lt":   "<",
+	"lte":  "<=",
+	"in":   "in",
+	"nin":  "not in",
+	"like": "like",
+}
+
+// QueryField 允许查询的字段（白名单）
+type QueryField struct {
+	Name   string // 查询参数中的名称
+	Column string // 数据库中的列名，为空时与Name相同
+	Type   QueryFieldType
+	// Operators 允许的操作符，为空时为该类型的所有操作符：eq ne gt gte lt lte in nin like null
+	Operators  []string
+	Filterable bool
+	Sortable   bool
+	Selectable bool
+}
+
+func (f *QueryField) column() string {
+	if f.Column == "" {
+		return f.Name
+	}
+	return f.Column
+}
+
+func (f *QueryField) allowOperator(op string) bool {
+	operators := f.Operators
+	if len(operators) == 0 {
+		operators = queryTypeOperators[f.Type]
+	}
+	for _, o := range operators {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryError 查询参数错误，实现了 controllers.IResponseException，在controller中返回时为400
+type QueryError struct {
+	Code       int
+	StatusCode int
+	Message    string
+}
+
+func newQueryError(format string, args ...any) *QueryError {
+	return &QueryError{Code: -1, StatusCode: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("[%v]: %s", e.Code, e.Message)
+}
+
+func (e *QueryError) GetCode() int {
+	return e.Code
+}
+
+func (e *QueryError) SetCode(code int) {
+	e.Code = code
+}
+
+func (e *QueryError) GetStatusCode() int {
+	return e.StatusCode
+}
+
+func (e *QueryError) SetStatusCode(statusCode int) {
+	e.StatusCode = statusCode
+}
+
+func (e *QueryError) GetMessage() string {
+	return e.Message
+}
+
+func (e *QueryError) SetMessage(message string) {
+	e.Message = message
+}
+
+// QuerySchema 将HTTP查询参数解析为 Query，只允许白名单中的字段
+//
+//	?filter[status]=active                 status = 'active'
+//	?filter[created_at][gte]=2024-01-01    created_at >= '2024-01-01'
+//	?filter[id][in]=1,2,3                  id IN (1, 2, 3)
+//	?filter[name][like]=abc                name LIKE '%abc%' ESCAPE '!'，值中的 % _ 会被转义
+//	?filter[deleted_at][null]=true         deleted_at IS NULL
+//	?sort=-created_at,id                   ORDER BY created_at DESC, id ASC
+//	?fields=id,name                        SELECT id, name
+type QuerySchema struct {
+	fields      map[string]*QueryField
+	defaultSort []string
+	maxValues   int
+}
+
+// like 的转义字符，不使用 \ 是因为MySQL的字符串中 \ 本身也需要转义
+const queryLikeEscape = "!"
+
+var queryLikeEscaper = strings.NewReplacer(queryLikeEscape, queryLikeEscape+queryLikeEscape, "%", queryLikeEscape+"%", "_", queryLikeEscape+"_")
+
+var queryFilterRegexp = regexp.MustCompile(`^filter\[([^\[\]]+)](?:\[([^\[\]]+)])?$`)
+
+func NewQuerySchema(fields ...QueryField) *QuerySchema {
+	s := &QuerySchema{
+		fields:    map[string]*QueryField{},
+		maxValues: 100,
+	}
+	for i := range fields {
+		s.fields[fields[i].Name] = &fields[i]
+	}
+	return s
+}
+
+// SetDefaultSort 没有sort参数时的排序，格式与sort参数相同，比如 "-created_at"，不受Sortable限制
+//
+//	字段必须在白名单中，否则会panic
+func (s *QuerySchema) SetDefaultSort(sort ...string) *QuerySchema {
+	var orders []string
+	for _, name := range sort {
+		order, err := s.parseSort(name, false)
+		if err != nil {
+			panic(err)
+		} else if order != "" {
+			orders = append(orders, order)
+		}
+	}
+	s.defaultSort = orders
+	return s
+}
+
+// parseSort 将 "-created_at" 转换为 "created_at DESC"，name为空时返回空
+func (s *QuerySchema) parseSort(name string, sortable bool) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil
+	}
+	direction := "ASC"
+	if strings.HasPrefix(name, "-") {
+		name, direction = name[1:], "DESC"
+	} else {
+		name = strings.TrimPrefix(name, "+")
+	}
+	field, ok := s.fields[name]
+	if !ok || (sortable && !field.Sortable) {
+		return "", newQueryError("field \"%s\" is not sortable", name)
+	}
+	return field.column() + " " + direction, nil
+}
+
+// SetMaxValues in/nin 中最多的值数量，默认100
+func (s *QuerySchema) SetMaxValues(maxValues int) *QuerySchema {
+	s.maxValues = maxValues
+	return s
+}
+
+// Query 解析之后的查询
+type Query struct {
+	Where  Where
+	Order  []string // 比如 "created_at DESC"
+	Select []string
+}
+
+// Scope 将Order和Select加入db，可以用于 db.Scopes 或 QuickOrm.Scopes
+//
+//	q, err := schema.Parse(ctx.Request.URL.Query())
+//	p, err := o.Scopes(q.Scope).Paginate(q.Where, page, pageSize, &users)
+func (q *Query) Scope(db *gorm.DB) *gorm.DB {
+	for _, order := range q.Order {
+		db = db.Order(order)
+	}
+	if len(q.Select) > 0 {
+		db = db.Select(q.Select)
+	}
+	return db
+}
+
+// Parse 解析查询参数，其它参数（比如page）会被忽略，错误为 *QueryError
+func (s *QuerySchema) Parse(values url.Values) (*Query, error) {
+	q := &Query{Where: Where{}}
+
+	// 按key排序，使生成的条件顺序固定
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		matches := queryFilterRegexp.FindStringSubmatch(key)
+		if matches == nil {
+			if strings.HasPrefix(key, "filter[") {
+				return nil, newQueryError("invalid filter \"%s\"", key)
+			}
+			continue
+		}
+		if len(values[key]) != 1 {
+			return nil, newQueryError("filter \"%s\" must have only one value", key)
+		}
+		if err := s.parseFilter(q.Where, matches[1], matches[2], values.Get(key)); err != nil {
+			return nil, err
+		}
+	}
+
+	if values.Has("sort") {
+		for _, name := range strings.Split(values.Get("sort"), ",") {
+			order, err := s.parseSort(name, true)
+			if err != nil {
+				return nil, err
+			} else if order != "" {
+				q.Order = append(q.Order, order)
+			}
+		}
+	} else {
+		q.Order = append(q.Order, s.defaultSort...)
+	}
+
+	if values.Has("fields") {
+		for _, name := range strings.Split(values.Get("fields"), ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			field, ok := s.fields[name]
+			if !ok || !field.Selectable {
+				return nil, newQueryError("field \"%s\" is not selectable", name)
+			}
+			q.Select = append(q.Select, field.column())
+		}
+	}
+	return q, nil
+}
+
+func (s *QuerySchema) parseFilter(where Where, name, op, value string) error {
+	field, ok := s.fields[name]
+	if !ok || !field.Filterable {
+		return newQueryError("field \"%s\" is not filterable", name)
+	}
+	if op == "" {
+		op = "eq"
+	}
+	if !field.allowOperator(op) {
+		return newQueryError("operator \"%s\" is not allowed on field \"%s\"", op, name)
+	}
+
+	column := field.column()
+	switch op {
+	case "null":
+		isNull, err := strconv.ParseBool(value)
+		if err != nil {
+			return newQueryError("filter[%s][null] must be true or false", name)
+		}
+		if isNull {
+			where[column+" is null"] = nil
+		} else {
+			where[column+" is not null"] = nil
+		}
+	case "in", "nin":
+		parts := strings.Split(value, ",")
+		if len(parts) > s.maxValues {
+			return newQueryError("filter[%s][%s] has too many values, max %d", name, op, s.maxValues)
+		}
+		list := make([]any, 0, len(parts))
+		for _, part := range parts {
+			v, err := field.convert(strings.TrimSpace(part))
+			if err != nil {
+				return err
+			}
+			list = append(list, v)
+		}
+		where[column+" "+queryOperators[op]] = list
+	case "like": // 转义值中的 % _，只做包含匹配
+		where[column+" LIKE ? ESCAPE '"+queryLikeEscape+"'"] = "%" + queryLikeEscaper.Replace(value) + "%"
+	default:
+		v, err := field.convert(value)
+		if err != nil {
+			return err
+		}
+		where[column+" "+queryOperators[op]] = v
+	}
+	return nil
+}
+
+// convert 将参数转换为字段的类型
+func (f *QueryField) convert(value string) (any, error) {
+	switch f.Type {
+	case QueryInt:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, newQueryError("the value of field \"%s\" must be an integer", f.Name)
+		}
+		return v, nil
+	case QueryFloat:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, newQueryError("the value of field \"%s\" must be a number", f.Name)
+		}
+		return v, nil
+	case QueryBool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, newQueryError("the value of field \"%s\" must be true or false", f.Name)
+		}
+		return v, nil
+	case QueryTime:
+		v, err := timeUtils.NewAnyTime(value)
+		if err != nil {
+			return nil, newQueryError("the value of field \"%s\" must be a time", f.Name)
+		}
+		return v.ToTime(), nil
+	}
+	return value, nil
+}
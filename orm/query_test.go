@@ -0,0 +1,117 @@
+package orm
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func newTestQuerySchema() *QuerySchema {
+	return NewQuerySchema(
+		QueryField{Name: "id", Type: QueryInt, Filterable: true, Sortable: true, Selectable: true},
+		QueryField{Name: "name", Type: QueryString, Filterable: true, Selectable: true},
+		QueryField{Name: "expired", Column: "expired_at", Type: QueryTime, Filterable: true, Operators: []string{"gte", "lt"}},
+	).SetDefaultSort("-id")
+}
+
+func TestQueryParse(t *testing.T) {
+	s := newTestQuerySchema()
+	tests := []struct {
+		query string
+		where Where
+		order []string
+		sel   []string
+	}{
+		{"", Where{}, []string{"id DESC"}, nil},
+		{"filter[id]=1", Where{"id =": int64(1)}, []string{"id DESC"}, nil},
+		{"filter[id][ne]=1", Where{"id !=": int64(1)}, []string{"id DESC"}, nil},
+		{"filter[id][gt]=1&filter[id][lte]=3", Where{"id >": int64(1), "id <=": int64(3)}, []string{"id DESC"}, nil},
+		{"filter[id][in]=1,2", Where{"id in": []any{int64(1), int64(2)}}, []string{"id DESC"}, nil},
+		{"filter[id][nin]=1", Where{"id not in": []any{int64(1)}}, []string{"id DESC"}, nil},
+		{"filter[name][like]=a%25_!b", Where{"name LIKE ? ESCAPE '!'": "%a!%!_!!b%"}, []string{"id DESC"}, nil},
+		{"filter[name][null]=true", Where{"name is null": nil}, []string{"id DESC"}, nil},
+		{"filter[name][null]=false", Where{"name is not null": nil}, []string{"id DESC"}, nil},
+		{"sort=id", Where{}, []string{"id ASC"}, nil},
+		{"sort=%2Bid,-id", Where{}, []string{"id ASC", "id DESC"}, nil},
+		{"fields=id,name&page=2", Where{}, []string{"id DESC"}, []string{"id", "name"}},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		q, err := s.Parse(values)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Where, tt.where) || !reflect.DeepEqual(q.Order, tt.order) || !reflect.DeepEqual(q.Select, tt.sel) {
+			t.Errorf("%q: got %v %v %v", tt.query, q.Where, q.Order, q.Select)
+		}
+	}
+
+	values, _ := url.ParseQuery("filter[expired][gte]=2030-01-02")
+	if q, err := s.Parse(values); err != nil || len(q.Where) != 1 || q.Where["expired_at >="] == nil {
+		t.Errorf("time filter: %v, %v", q, err)
+	}
+}
+
+func TestQueryParseRejected(t *testing.T) {
+	s := newTestQuerySchema()
+	for _, query := range []string{
+		"filter[unknown]=1",              // 不在白名单中
+		"filter[id]]=1",                  // 格式错误
+		"filter[id]=1&filter[id]=2",      // 多个值
+		"filter[id][like]=1",             // 类型不允许的操作符
+		"filter[expired][gt]=2030-01-01", // 字段不允许的操作符
+		"filter[id][regexp]=1",           // 未知的操作符
+		"filter[id]=abc",                 // 类型错误
+		"filter[expired][gte]=abc",       // 类型错误
+		"filter[name][null]=abc",         // null 只能是 true/false
+		"sort=name",                      // 不能排序
+		"sort=unknown",                   // 不在白名单中
+		"fields=expired",                 // 不能select
+	} {
+		values, _ := url.ParseQuery(query)
+		_, err := s.Parse(values)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) || queryErr.GetStatusCode() != 400 {
+			t.Errorf("%q: expected QueryError, got %v", query, err)
+		}
+	}
+
+	values, _ := url.ParseQuery("filter[id][in]=1,2,3")
+	if _, err := s.SetMaxValues(2).Parse(values); err == nil {
+		t.Errorf("too many values: expected error")
+	}
+}
+
+func TestQueryDefaultSort(t *testing.T) {
+	// 默认排序不受Sortable限制
+	NewQuerySchema(QueryField{Name: "name"}).SetDefaultSort("name")
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("unknown default sort field: expected panic")
+		}
+	}()
+	NewQuerySchema(QueryField{Name: "name"}).SetDefaultSort("-unknown")
+}
+
+func TestQueryLike(t *testing.T) {
+	o := newTestSqlite(t)
+	for _, name := range []string{"a%b", "axb", "a_b"} {
+		if _, err := o.CreateModel(&testSite{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestQuerySchema()
+	for value, expected := range map[string]int64{"%": 1, "_": 1, "a": 3, "x": 1} {
+		q, err := s.Parse(url.Values{"filter[name][like]": {value}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := o.GetCount(&testSite{}, q.Where); err != nil || n != expected {
+			t.Errorf("like %q: %d, %v, expected %d", value, n, err, expected)
+		}
+	}
+}
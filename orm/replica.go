@@ -0,0 +1,264 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ReplicaPolicyWeighted   = "weighted"
+	ReplicaPolicyRoundRobin = "round_robin"
+)
+
+type replica struct {
+	address  string
+	pool     *sql.DB
+	weight   int
+	healthy  atomic.Bool
+	failures int
+}
+
+// replicaPolicy 实现 dbresolver.Policy，只在健康的副本中选择，没有健康的副本时使用主库
+//
+//	同时作为gorm的插件注册到db中，用于 CloseORM 时停止健康检查、关闭副本的连接池
+type replicaPolicy struct {
+	policy   string
+	replicas []*replica
+	primary  gorm.ConnPool
+	counter  atomic.Uint64
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ dbresolver.Policy = (*replicaPolicy)(nil)
+var _ gorm.Plugin = (*replicaPolicy)(nil)
+
+const replicaPluginName = "orm:replicas"
+
+func (p *replicaPolicy) Name() string {
+	return replicaPluginName
+}
+
+func (p *replicaPolicy) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// Close 停止健康检查，并关闭所有副本的连接池，可以重复调用
+func (p *replicaPolicy) Close() error {
+	var errs error
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		for _, r := range p.replicas {
+			errs = multierr.Append(errs, errors.WithMessagef(r.pool.Close(), "close replica %s", r.address))
+		}
+	})
+	return errs
+}
+
+func (p *replicaPolicy) Resolve([]gorm.ConnPool) gorm.ConnPool {
+	var healthy []*replica
+	total := 0
+	for _, r := range p.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r)
+			total += r.weight
+		}
+	}
+	if len(healthy) == 0 {
+		return p.primary
+	}
+
+	if p.policy == ReplicaPolicyRoundRobin {
+		return healthy[p.counter.Add(1)%uint64(len(healthy))].pool
+	}
+	n := rand.Intn(total)
+	for _, r := range healthy {
+		if n -= r.weight; n < 0 {
+			return r.pool
+		}
+	}
+	return healthy[len(healthy)-1].pool
+}
+
+// useReplicas 为db注册读写分离，并启动副本的健康检查，使用 CloseORM 停止
+func useReplicas(db *gorm.DB, dbOptions *DBOptions, zapLogger *zap.Logger) (err error) {
+	primary, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	policy := &replicaPolicy{policy: dbOptions.ReplicaPolicy, primary: primary, stop: make(chan struct{})}
+	defer func() {
+		if err != nil { // 关闭已经打开的副本
+			_ = policy.Close()
+		}
+	}()
+
+	var dialectors []gorm.Dialector
+	for _, replicaOptions := range dbOptions.Replicas {
+		options := *dbOptions
+		options.Address = replicaOptions.Address
+		if replicaOptions.User != "" {
+			options.User, options.Password = replicaOptions.User, replicaOptions.Password
+		}
+		// 副本不可用时不影响启动，所以跳过版本查询
+		options.SkipInitializeWithVersion = true
+
+		var dsn string
+		if dsn, err = BuildDSN(&options); err != nil {
+			return err
+		}
+		var pool *sql.DB
+		pool, err = sql.Open(sqlDriverName(options.Driver), dsn)
+		if err != nil {
+			return errors.WithMessagef(err, "open replica %s", replicaOptions.Address)
+		}
+		pool.SetMaxIdleConns(dbOptions.MaxIdleConns)
+		pool.SetMaxOpenConns(dbOptions.MaxOpenConns)
+		pool.SetConnMaxIdleTime(dbOptions.MaxIdleTime)
+		pool.SetConnMaxLifetime(dbOptions.MaxLifeTime)
+
+		r := &replica{address: replicaOptions.Address, pool: pool, weight: replicaOptions.Weight}
+		if r.weight <= 0 {
+			r.weight = 1
+		}
+		r.healthy.Store(true)
+		policy.replicas = append(policy.replicas, r)
+		var dialector gorm.Dialector
+		if dialector, err = NewDialector(&options, pool); err != nil {
+			return err
+		}
+		dialectors = append(dialectors, dialector)
+	}
+
+	// 主库也加入候选，dbresolver只有一个副本时不会调用policy，无法回退到主库
+	options := *dbOptions
+	options.SkipInitializeWithVersion = true
+	dialector, err := NewDialector(&options, primary)
+	if err != nil {
+		return err
+	}
+	dialectors = append(dialectors, dialector)
+	if err = db.Use(dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: policy})); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = registerReadYourWrites(db); err != nil {
+		return err
+	}
+	if err = db.Use(policy); err != nil {
+		return errors.WithStack(err)
+	}
+
+	go policy.healthCheck(dbOptions.ReplicaHealthCheckInterval, dbOptions.ReplicaMaxFailures, zapLogger)
+	return nil
+}
+
+// healthCheck 定时Ping副本，连续失败maxFailures次之后剔除，成功之后恢复；Close 之后退出
+func (p *replicaPolicy) healthCheck(interval time.Duration, maxFailures int, zapLogger *zap.Logger) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	if maxFailures <= 0 {
+		maxFailures = 3
+	}
+	logger := zapLogger.Sugar()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		var wg sync.WaitGroup
+		for _, r := range p.replicas {
+			wg.Add(1)
+			go func(r *replica) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				defer cancel()
+
+				if err := r.pool.PingContext(ctx); err != nil {
+					r.failures++
+					if r.failures == maxFailures {
+						r.healthy.Store(false)
+						logger.Errorf("[ORM]replica %s is ejected after %d failures: %s", r.address, r.failures, err.Error())
+					}
+				} else if r.failures > 0 {
+					if r.failures >= maxFailures {
+						r.healthy.Store(true)
+						logger.Infof("[ORM]replica %s is recovered", r.address)
+					}
+					r.failures = 0
+				}
+			}(r)
+		}
+		wg.Wait()
+	}
+}
+
+type readYourWritesKey struct{}
+
+type readYourWrites struct {
+	written atomic.Bool
+	primary bool
+}
+
+// WithReadYourWrites 返回一个新的ctx，使用此ctx（db.WithContext(ctx)）进行写操作之后，后续的读操作都会使用主库，
+// 用于避免一个请求中写入之后立即读取时，副本还没有同步
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, &readYourWrites{})
+}
+
+// WithPrimary 返回一个新的ctx，使用此ctx的所有读操作都使用主库
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, &readYourWrites{primary: true})
+}
+
+func readYourWritesFrom(db *gorm.DB) *readYourWrites {
+	if db.Statement.Context == nil {
+		return nil
+	}
+	state, _ := db.Statement.Context.Value(readYourWritesKey{}).(*readYourWrites)
+	return state
+}
+
+func registerReadYourWrites(db *gorm.DB) error {
+	markWritten := func(db *gorm.DB) {
+		if state := readYourWritesFrom(db); state != nil && db.Error == nil {
+			state.written.Store(true)
+		}
+	}
+	usePrimary := func(db *gorm.DB) {
+		if state := readYourWritesFrom(db); state != nil && (state.primary || state.written.Load()) {
+			dbresolver.Write.ModifyStatement(db.Statement)
+		}
+	}
+
+	callback := db.Callback()
+	for _, err := range []error{
+		callback.Create().After("gorm:create").Register("orm:read_your_writes", markWritten),
+		callback.Update().After("gorm:update").Register("orm:read_your_writes", markWritten),
+		callback.Delete().After("gorm:delete").Register("orm:read_your_writes", markWritten),
+		callback.Raw().After("gorm:raw").Register("orm:read_your_writes", markWritten),
+		callback.Query().Before("gorm:query").Register("orm:read_your_writes", usePrimary),
+		callback.Row().Before("gorm:row").Register("orm:read_your_writes", usePrimary),
+	} {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
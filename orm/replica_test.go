@@ -0,0 +1,158 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+	"testing"
+)
+
+func newTestReplica(t *testing.T, address string) *replica {
+	pool, err := sql.Open("sqlite3", t.TempDir()+"/"+address+".db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pool.Close() })
+	r := &replica{address: address, pool: pool, weight: 1}
+	r.healthy.Store(true)
+	return r
+}
+
+func TestReplicaPolicyResolve(t *testing.T) {
+	primary := newTestReplica(t, "primary").pool
+	a, b := newTestReplica(t, "a"), newTestReplica(t, "b")
+
+	policy := &replicaPolicy{policy: ReplicaPolicyRoundRobin, replicas: []*replica{a, b}, primary: primary}
+	first, second := policy.Resolve(nil), policy.Resolve(nil)
+	if first == second || (first != a.pool && first != b.pool) || (second != a.pool && second != b.pool) {
+		t.Errorf("round robin must alternate between replicas")
+	}
+
+	// 剔除的副本不会被选中
+	a.healthy.Store(false)
+	for _, p := range []string{ReplicaPolicyRoundRobin, ReplicaPolicyWeighted} {
+		policy.policy = p
+		for i := 0; i < 10; i++ {
+			if policy.Resolve(nil) != b.pool {
+				t.Fatalf("%s: unhealthy replica must not be resolved", p)
+			}
+		}
+	}
+
+	// 没有健康的副本时使用主库
+	b.healthy.Store(false)
+	if policy.Resolve(nil) != primary {
+		t.Errorf("must fall back to primary")
+	}
+}
+
+// newTestReplicaOrm 主库和副本为两个不同的SQLite文件，副本中只有一条 name = "replica" 的数据
+func newTestReplicaOrm(t *testing.T) (*QuickOrm, *replica) {
+	o := newTestSqlite(t)
+
+	r := newTestReplica(t, "replica")
+	replicaDB, err := gorm.Open(&sqlite.Dialector{Conn: r.pool}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = replicaDB.AutoMigrate(&testSite{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = replicaDB.Create(&testSite{Name: "replica"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	primary, err := o.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &replicaPolicy{policy: ReplicaPolicyRoundRobin, replicas: []*replica{r}, primary: primary, stop: make(chan struct{})}
+	if err = o.DB.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{&sqlite.Dialector{Conn: r.pool}, &sqlite.Dialector{Conn: primary}},
+		Policy:   policy,
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err = registerReadYourWrites(o.DB); err != nil {
+		t.Fatal(err)
+	}
+	return o, r
+}
+
+func readSiteName(t *testing.T, o *QuickOrm, ctx context.Context) string {
+	t.Helper()
+	var names []string
+	if err := o.DB.WithContext(ctx).Model(&testSite{}).Order("id").Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	} else if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+func TestReadYourWrites(t *testing.T) {
+	o, r := newTestReplicaOrm(t)
+	if err := o.DB.Create(&testSite{Name: "primary"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if name := readSiteName(t, o, context.Background()); name != "replica" {
+		t.Errorf("read must use replica, got %q", name)
+	}
+	if name := readSiteName(t, o, WithPrimary(context.Background())); name != "primary" {
+		t.Errorf("WithPrimary must use primary, got %q", name)
+	}
+
+	ctx := WithReadYourWrites(context.Background())
+	if name := readSiteName(t, o, ctx); name != "replica" {
+		t.Errorf("read before write must use replica, got %q", name)
+	}
+	if err := o.DB.WithContext(ctx).Model(&testSite{}).Where("name = ?", "primary").Update("name", "written").Error; err != nil {
+		t.Fatal(err)
+	}
+	if name := readSiteName(t, o, ctx); name != "written" {
+		t.Errorf("read after write must use primary, got %q", name)
+	}
+	if name := readSiteName(t, o, context.Background()); name != "replica" {
+		t.Errorf("other ctx must still use replica, got %q", name)
+	}
+
+	// 副本被剔除之后使用主库
+	r.healthy.Store(false)
+	if name := readSiteName(t, o, context.Background()); name != "written" {
+		t.Errorf("read must fall back to primary, got %q", name)
+	}
+}
+
+func TestCloseORM(t *testing.T) {
+	options := DefaultDBOptions()
+	options.Driver = DriverSqlite
+	options.DBName = t.TempDir() + "/test.db"
+	options.Replicas = []ReplicaOptions{{Address: "replica"}}
+
+	db, err := NewORM(options, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, ok := db.Config.Plugins[replicaPluginName].(*replicaPolicy)
+	if !ok {
+		t.Fatal("replica plugin is not registered")
+	}
+
+	if err = CloseORM(db); err != nil {
+		t.Fatal(err)
+	}
+	if err = policy.replicas[0].pool.Ping(); err == nil {
+		t.Errorf("replica pool must be closed")
+	}
+	if sqlDB, _ := db.DB(); sqlDB.Ping() == nil {
+		t.Errorf("primary pool must be closed")
+	}
+	// 重复关闭副本不会panic
+	if err = policy.Close(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,162 @@
+package orm
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Repo 泛型的数据访问层，基于 QuickOrm，会带上 QuickOrm 的 defaultWhere
+//
+//	users := orm.NewRepo[User](o, "Roles")
+//	user, err := users.FindOne(Where{"id": 1}) // 没有找到时 user 为 nil
+//	list, err := users.Find(Where{"name like ?": "%abc%"})
+type Repo[T any] struct {
+	orm      *QuickOrm
+	preloads []string
+}
+
+// NewRepo preloads 为 FindOne/Find 默认需要加载的关联关系
+func NewRepo[T any](orm *QuickOrm, preloads ...string) *Repo[T] {
+	return &Repo[T]{
+		orm:      orm,
+		preloads: preloads,
+	}
+}
+
+// WithPreloads 返回一个增加了 preloads 的新 Repo，不会修改原 Repo
+func (r *Repo[T]) WithPreloads(preloads ...string) *Repo[T] {
+	return &Repo[T]{
+		orm:      r.orm,
+		preloads: append(append([]string(nil), r.preloads...), preloads...),
+	}
+}
+
+func (r *Repo[T]) Orm() *QuickOrm {
+	return r.orm
+}
+
+func (r *Repo[T]) mergePreloads(preloads []string) []string {
+	if len(preloads) == 0 {
+		return r.preloads
+	}
+	return append(append([]string(nil), r.preloads...), preloads...)
+}
+
+// FindOne 获取第一个符合条件的model，没有找到时返回 nil, nil
+func (r *Repo[T]) FindOne(kv Where, preloads ...string) (*T, error) {
+	var model T
+	n, err := r.orm.GetModel(kv, &model, r.mergePreloads(preloads)...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	} else if n == 0 {
+		return nil, nil
+	}
+	return &model, nil
+}
+
+// Find 获取符合条件的models
+func (r *Repo[T]) Find(kv Where, preloads ...string) ([]T, error) {
+	var models []T
+	if _, err := r.orm.GetModels(kv, &models, r.mergePreloads(preloads)...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return models, nil
+}
+
+func (r *Repo[T]) Count(kv Where) (int64, error) {
+	c, err := r.orm.GetCount(new(T), kv)
+	return c, errors.WithStack(err)
+}
+
+// Exists 是否存在符合条件的记录，使用 LIMIT 1 查询，比 Count 更快
+func (r *Repo[T]) Exists(kv Where) (bool, error) {
+	var ones []int
+	db := r.orm.BuildWhere(r.orm.DB.Model(new(T)), kv)
+	if err := db.Select("1").Limit(1).Find(&ones).Error; err != nil {
+		return false, errors.WithStack(err)
+	}
+	return len(ones) > 0, nil
+}
+
+// Create 创建单个model，可以传递需要被忽略的列名，自增ID等会回写到model
+func (r *Repo[T]) Create(model *T, omitColumns ...string) error {
+	_, err := r.orm.CreateModel(model, omitColumns...)
+	return errors.WithStack(err)
+}
+
+// CreateMany 分批创建models，batchSize <= 0 时一次性创建
+func (r *Repo[T]) CreateMany(models []T, batchSize int, omitColumns ...string) error {
+	if len(models) == 0 {
+		return nil
+	} else if batchSize <= 0 {
+		batchSize = len(models)
+	}
+	return errors.WithStack(r.orm.DB.Omit(omitColumns...).CreateInBatches(models, batchSize).Error)
+}
+
+// Update 按照条件修改，updateKvs 为 KVs 或者 T（只会修改非零字段），参见 QuickOrm.UpdateModels
+//
+//	users.Update(Where{"name": "abc"}, KVs{"gender": "female"})
+func (r *Repo[T]) Update(kv Where, updateKvs any) (int64, error) {
+	n, err := r.orm.UpdateModels(new(T), kv, updateKvs)
+	return n, errors.WithStack(err)
+}
+
+// UpdateModel 修改单个model，model的主键会加入where条件
+func (r *Repo[T]) UpdateModel(model *T, updateKvs any) (int64, error) {
+	n, err := r.orm.UpdateModel(model, updateKvs)
+	return n, errors.WithStack(err)
+}
+
+// Delete 按照条件删除，条件为空时会报错：ErrMissingWhereClause
+func (r *Repo[T]) Delete(kv Where) (int64, error) {
+	n, err := r.orm.DeleteModels(new(T), kv)
+	return n, errors.WithStack(err)
+}
+
+// DeleteModel 删除指定的model，model的主键会加入where条件
+func (r *Repo[T]) DeleteModel(model *T) (int64, error) {
+	n, err := r.orm.DeleteModels(model, nil)
+	return n, errors.WithStack(err)
+}
+
+// Transaction 在事务中执行fn，fn中的 Repo 使用事务的连接，并保留 defaultWhere 和 preloads
+func (r *Repo[T]) Transaction(fn func(tx *Repo[T]) error) error {
+	return r.orm.DB.Transaction(func(db *gorm.DB) error {
+		return fn(&Repo[T]{
+			orm:      &QuickOrm{DB: db, defaultWhere: r.orm.defaultWhere, versionColumn: r.orm.versionColumn},
+			preloads: r.preloads,
+		})
+	})
+}
+
+// preloaded 返回带上 preloads 的 QuickOrm
+func (r *Repo[T]) preloaded() *QuickOrm {
+	db := r.orm.DB
+	for _, preload := range r.preloads {
+		db = db.Preload(preload)
+	}
+	return &QuickOrm{DB: db, defaultWhere: r.orm.defaultWhere, versionColumn: r.orm.versionColumn}
+}
+
+// Paginate 按页码分页，返回的 Items 为 []T，参见 QuickOrm.Paginate
+func (r *Repo[T]) Paginate(kv Where, page, pageSize int, orderBy ...string) (*Pagination, error) {
+	models := make([]T, 0)
+	p, err := r.preloaded().Paginate(kv, page, pageSize, &models, orderBy...)
+	if err != nil {
+		return nil, err
+	}
+	p.Items = models
+	return p, nil
+}
+
+// KeysetPaginate 按游标分页，返回的 Items 为 []T，参见 QuickOrm.KeysetPaginate
+func (r *Repo[T]) KeysetPaginate(kv Where, orderBy []string, cursor string, limit int) (*CursorPagination, error) {
+	models := make([]T, 0)
+	p, err := r.preloaded().KeysetPaginate(kv, orderBy, cursor, limit, &models)
+	if err != nil {
+		return nil, err
+	}
+	p.Items = models
+	return p, nil
+}
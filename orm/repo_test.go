@@ -0,0 +1,72 @@
+package orm
+
+import (
+	"github.com/pkg/errors"
+	"testing"
+)
+
+func TestRepo(t *testing.T) {
+	o := newTestSqlite(t)
+	sites := NewRepo[testSite](o)
+
+	site := &testSite{Name: "a"}
+	if err := sites.Create(site); err != nil {
+		t.Fatal(err)
+	} else if site.ID == 0 {
+		t.Fatal("auto increment id is not written back")
+	}
+
+	if actual, err := sites.FindOne(Where{"id": site.ID}); err != nil || actual == nil || actual.Name != "a" {
+		t.Fatalf("find one: %+v, %v", actual, err)
+	}
+	if actual, err := sites.FindOne(Where{"id": site.ID + 1}); err != nil || actual != nil {
+		t.Fatalf("find one not found: %+v, %v", actual, err)
+	}
+
+	if n, err := sites.Update(Where{"id": site.ID}, KVs{"name": "b"}); err != nil || n != 1 {
+		t.Fatalf("update: %d, %v", n, err)
+	}
+	if n, err := sites.UpdateModel(site, KVs{"name": "c"}); err != nil || n != 1 {
+		t.Fatalf("update model: %d, %v", n, err)
+	}
+	if exists, err := sites.Exists(Where{"name": "c"}); err != nil || !exists {
+		t.Fatalf("exists: %v, %v", exists, err)
+	}
+
+	// 事务中返回错误时回滚
+	rollback := errors.New("rollback")
+	err := sites.Transaction(func(tx *Repo[testSite]) error {
+		if err := tx.Create(&testSite{Name: "d"}); err != nil {
+			return err
+		}
+		if n, err := tx.Count(Where{"name": "d"}); err != nil || n != 1 {
+			t.Errorf("count in transaction: %d, %v", n, err)
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("transaction: %v", err)
+	}
+	if n, err := sites.Count(nil); err != nil || n != 1 {
+		t.Fatalf("count after rollback: %d, %v", n, err)
+	}
+
+	if err = sites.Transaction(func(tx *Repo[testSite]) error {
+		return tx.Create(&testSite{Name: "d"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := sites.Find(nil); err != nil || len(list) != 2 {
+		t.Fatalf("find after commit: %+v, %v", list, err)
+	}
+
+	if n, err := sites.Delete(Where{"name": "d"}); err != nil || n != 1 {
+		t.Fatalf("delete: %d, %v", n, err)
+	}
+	if n, err := sites.DeleteModel(site); err != nil || n != 1 {
+		t.Fatalf("delete model: %d, %v", n, err)
+	}
+	if n, err := sites.Count(nil); err != nil || n != 0 {
+		t.Fatalf("count after delete: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"gopkg.in/go-mixed/go-common.v1/utils/time"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"time"
+)
+
+// AnyTime 重写timeUtils.AnyTime 为orm.AnyTime，按数据库类型建表：PostgreSQL为timestamptz，其它数据库（比如MySQL）为datetime
+type AnyTime timeUtils.AnyTime
+
+func NewAnyTime(value any) (AnyTime, error) {
+	t, err := timeUtils.NewAnyTime(value)
+	return AnyTime(t), err
+}
+
+func (t AnyTime) ToTime() time.Time {
+	return time.Time(t)
+}
+
+func (t *AnyTime) UnmarshalJSON(data []byte) error {
+	return (*timeUtils.AnyTime)(t).UnmarshalJSON(data)
+}
+
+func (t AnyTime) MarshalJSON() ([]byte, error) {
+	return timeUtils.AnyTime(t).MarshalJSON()
+}
+
+// Scan for sql decode, SQLite等驱动可能返回字符串
+func (t *AnyTime) Scan(value any) error {
+	return (*timeUtils.AnyTime)(t).Scan(value)
+}
+
+// Value for sql encode
+func (t AnyTime) Value() (driver.Value, error) {
+	return timeUtils.AnyTime(t).Value()
+}
+
+// GormDataType gorm common data type
+func (AnyTime) GormDataType() string {
+	return "datetime"
+}
+
+// GormDBDataType gorm db data type，PostgreSQL没有datetime类型，使用timestamptz
+func (AnyTime) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		if field.Precision > 0 {
+			return fmt.Sprintf("timestamptz(%d)", field.Precision)
+		}
+		return "timestamptz"
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"regexp"
+	"strconv"
+)
+
+var decimalRegexp = regexp.MustCompile(`^[+-]?\d+(\.\d+)?$`)
+
+// Decimal 以字符串保存的定点数，避免float64的精度问题，空字符串为NULL。
+// 列的精度可以通过tag设置，默认为 DECIMAL(20,8)，SQLite中为TEXT（NUMERIC会转换为浮点数）
+//
+//	Price types.Decimal `gorm:"precision:12;scale:2"`
+type Decimal string
+
+// NewDecimal 校验s是否为定点数，比如 "-1.23"
+func NewDecimal(s string) (Decimal, error) {
+	if !decimalRegexp.MatchString(s) {
+		return "", errors.Errorf("invalid decimal \"%s\"", s)
+	}
+	return Decimal(s), nil
+}
+
+func (d Decimal) String() string {
+	return string(d)
+}
+
+func (d Decimal) Float64() (float64, error) {
+	return strconv.ParseFloat(string(d), 64)
+}
+
+func (d *Decimal) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*d = ""
+	case []byte:
+		*d = Decimal(v)
+	case string:
+		*d = Decimal(v)
+	case int64:
+		*d = Decimal(strconv.FormatInt(v, 10))
+	case float64:
+		*d = Decimal(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return errors.New(fmt.Sprint("Failed to scan decimal value:", value))
+	}
+	return nil
+}
+
+func (d Decimal) Value() (driver.Value, error) {
+	if d == "" {
+		return nil, nil
+	}
+	if _, err := NewDecimal(string(d)); err != nil {
+		return nil, err
+	}
+	return string(d), nil
+}
+
+// GormDataType gorm common data type
+func (Decimal) GormDataType() string {
+	return "decimal"
+}
+
+// GormDBDataType gorm db data type
+func (Decimal) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	precision, scale := 20, 8
+	if field.Precision > 0 {
+		precision, scale = field.Precision, field.Scale
+	}
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return "TEXT"
+	case "mysql", "sqlserver":
+		return fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+	case "postgres":
+		return fmt.Sprintf("NUMERIC(%d,%d)", precision, scale)
+	}
+	return ""
+}
+
+// MarshalJSON 输出为字符串，避免前端的精度问题，空字符串为null
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if d == "" {
+		return []byte("null"), nil
+	}
+	return []byte(strconv.Quote(string(d))), nil
+}
+
+// UnmarshalJSON 可以是字符串或者数字
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		*d = ""
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	v, err := NewDecimal(s)
+	*d = v
+	return err
+}
@@ -0,0 +1,89 @@
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"strconv"
+	"time"
+)
+
+// Duration 以纳秒（BIGINT）存储的 time.Duration，JSON中为 "1h30m0s" 格式的字符串
+type Duration time.Duration
+
+func (d Duration) ToDuration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*d = 0
+	case int64:
+		*d = Duration(v)
+	case []byte, string:
+		n, err := strconv.ParseInt(fmt.Sprintf("%s", v), 10, 64)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		*d = Duration(n)
+	default:
+		return errors.New(fmt.Sprint("Failed to scan duration value:", value))
+	}
+	return nil
+}
+
+func (d Duration) Value() (driver.Value, error) {
+	return int64(d), nil
+}
+
+// GormDataType gorm common data type
+func (Duration) GormDataType() string {
+	return "duration"
+}
+
+// GormDBDataType gorm db data type
+func (Duration) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return "INTEGER"
+	case "mysql", "postgres", "sqlserver":
+		return "BIGINT"
+	}
+	return ""
+}
+
+// MarshalJSON 输出为 "1h30m0s" 格式的字符串
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return textUtils.JsonMarshalToBytes(d.String())
+}
+
+// UnmarshalJSON 可以是 "1h30m" 格式的字符串或者纳秒数
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := textUtils.JsonUnmarshalFromBytes(b, &v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case nil:
+		*d = 0
+	case float64:
+		*d = Duration(t)
+	case string:
+		n, err := time.ParseDuration(t)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		*d = Duration(n)
+	default:
+		return errors.Errorf("invalid duration %s", string(b))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils/crypt"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"sync/atomic"
+)
+
+var encryptionKeys atomic.Pointer[[][]byte]
+
+// SetEncryptionKeys 设置 EncryptedString 的密钥，key为16、24、32位，分别对应AES-128，AES-192，AES-256。
+// 使用key加密；解密时依次尝试key和oldKeys，用于更换密钥
+func SetEncryptionKeys(key []byte, oldKeys ...[]byte) error {
+	keys := append([][]byte{key}, oldKeys...)
+	for _, k := range keys {
+		if l := len(k); l != 16 && l != 24 && l != 32 {
+			return errors.Errorf("invalid AES key size %d, must be 16, 24 or 32", l)
+		}
+	}
+	encryptionKeys.Store(&keys)
+	return nil
+}
+
+// EncryptedString 使用AES-GCM加密之后以base64存储的字符串，使用之前需要调用 SetEncryptionKeys。
+// 每次加密的结果不同，所以不能用于查询条件和索引；空字符串不加密。
+// JSON中为明文，输出到接口时需要注意
+type EncryptedString string
+
+func (s *EncryptedString) Scan(value any) error {
+	var data string
+	switch v := value.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case []byte:
+		data = string(v)
+	case string:
+		data = v
+	default:
+		return errors.New(fmt.Sprint("Failed to decrypt value:", value))
+	}
+	if data == "" {
+		*s = ""
+		return nil
+	}
+
+	keys := encryptionKeys.Load()
+	if keys == nil {
+		return errors.New("encryption key of EncryptedString is not set")
+	}
+	var err error
+	for _, key := range *keys {
+		var plain []byte
+		if plain, err = encryptUtils.DecryptByAesGcm(data, key); err == nil {
+			*s = EncryptedString(plain)
+			return nil
+		}
+	}
+	return err
+}
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	keys := encryptionKeys.Load()
+	if keys == nil {
+		return nil, errors.New("encryption key of EncryptedString is not set")
+	}
+	return encryptUtils.EncryptByAesGcm([]byte(s), (*keys)[0])
+}
+
+func (s EncryptedString) String() string {
+	return string(s)
+}
+
+// GormDataType gorm common data type
+func (EncryptedString) GormDataType() string {
+	return "encrypted_string"
+}
+
+// GormDBDataType 密文比明文长，所以使用TEXT
+func (EncryptedString) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "sqlite", "mysql", "postgres":
+		return "TEXT"
+	case "sqlserver":
+		return "NVARCHAR(MAX)"
+	}
+	return ""
+}
+
+// MarshalJSON 输出为明文
+func (s EncryptedString) MarshalJSON() ([]byte, error) {
+	return textUtils.JsonMarshalToBytes(string(s))
+}
+
+// UnmarshalJSON to deserialize []byte
+func (s *EncryptedString) UnmarshalJSON(b []byte) error {
+	var t string
+	err := textUtils.JsonUnmarshalFromBytes(b, &t)
+	*s = EncryptedString(t)
+	return err
+}
@@ -43,7 +43,8 @@ func (m Int64Slice) Value() (driver.Value, error) {
 	if len(m) == 0 {
 		return nil, nil
 	}
-	return textUtils.JsonMarshalToBytes(m)
+	// 返回字符串而不是[]byte，PostgreSQL会将[]byte视为bytea
+	return textUtils.JsonMarshal(m)
 }
 
 // GormDataType gorm common data type
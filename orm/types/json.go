@@ -0,0 +1,116 @@
+package types
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"strings"
+)
+
+// JSON 将任意的struct或者map以JSON的格式存储
+//
+//	type Site struct {
+//		Settings types.JSON[SiteSettings]
+//	}
+//	site.Settings = types.NewJSON(SiteSettings{...})
+//	site.Settings.Data.Theme
+type JSON[T any] struct {
+	Data T
+}
+
+func NewJSON[T any](data T) JSON[T] {
+	return JSON[T]{Data: data}
+}
+
+// Value return json value, implement driver.Valuer interface
+func (j JSON[T]) Value() (driver.Value, error) {
+	// 返回字符串而不是[]byte，PostgreSQL会将[]byte视为bytea
+	return textUtils.JsonMarshal(j.Data)
+}
+
+// Scan scan value into JSON, implements sql.Scanner interface
+func (j *JSON[T]) Scan(val any) error {
+	var data T
+	if val == nil {
+		j.Data = data
+		return nil
+	}
+	ba, err := jsonBytes(val)
+	if err != nil {
+		return err
+	}
+	err = textUtils.JsonUnmarshalFromBytes(ba, &data)
+	j.Data = data
+	return err
+}
+
+// MarshalJSON 输出为Data的JSON
+func (j JSON[T]) MarshalJSON() ([]byte, error) {
+	return textUtils.JsonMarshalToBytes(j.Data)
+}
+
+// UnmarshalJSON to deserialize []byte
+func (j *JSON[T]) UnmarshalJSON(b []byte) error {
+	var data T
+	err := textUtils.JsonUnmarshalFromBytes(b, &data)
+	j.Data = data
+	return err
+}
+
+// GormDataType gorm common data type
+func (JSON[T]) GormDataType() string {
+	return "json"
+}
+
+// GormDBDataType gorm db data type
+func (JSON[T]) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDBDataType(db)
+}
+
+func (j JSON[T]) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	data, _ := j.MarshalJSON()
+	return jsonGormValue(db, data)
+}
+
+// jsonBytes Scan时数据库返回的JSON，MySQL为[]byte，SQLite、PostgreSQL可能为string
+func jsonBytes(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, errors.New(fmt.Sprint("Failed to unmarshal JSONB value:", val))
+}
+
+// jsonDBDataType JSON列在各数据库中的类型
+func jsonDBDataType(db *gorm.DB) string {
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return "JSON"
+	case "mysql":
+		return "JSON"
+	case "postgres":
+		return "JSONB"
+	case "sqlserver":
+		return "NVARCHAR(MAX)"
+	}
+	return ""
+}
+
+// jsonGormValue MySQL（非MariaDB）需要 CAST(? AS JSON)
+func jsonGormValue(db *gorm.DB, data []byte) clause.Expr {
+	switch db.Dialector.Name() {
+	case "mysql":
+		if v, ok := db.Dialector.(*mysql.Dialector); ok && !strings.Contains(v.ServerVersion, "MariaDB") {
+			return gorm.Expr("CAST(? AS JSON)", string(data))
+		}
+	}
+	return gorm.Expr("?", string(data))
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"gopkg.in/go-mixed/go-common.v1/utils/list"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"sort"
+)
+
+// Set 以JSON数组的格式存储的 listUtils.Set，数组按元素的字符串排序，使相同的Set存储的值相同
+type Set[T comparable] listUtils.Set[T]
+
+func NewSet[T comparable](items ...T) Set[T] {
+	return Set[T](listUtils.NewSet(items...))
+}
+
+// Set 转换为 listUtils.Set，可以使用 Contains、Union 等方法
+func (s Set[T]) Set() listUtils.Set[T] {
+	return listUtils.Set[T](s)
+}
+
+// sorted 排序之后的元素
+func (s Set[T]) sorted() []T {
+	items := s.Set().ToSlice()
+	sort.Slice(items, func(i, j int) bool {
+		return fmt.Sprint(items[i]) < fmt.Sprint(items[j])
+	})
+	return items
+}
+
+func (s *Set[T]) Scan(value any) error {
+	if value == nil {
+		*s = Set[T](nil)
+		return nil
+	}
+	ba, err := jsonBytes(value)
+	if err != nil {
+		return err
+	}
+	return s.UnmarshalJSON(ba)
+}
+
+func (s Set[T]) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return textUtils.JsonMarshal(s.sorted())
+}
+
+// GormDataType gorm common data type
+func (Set[T]) GormDataType() string {
+	return "set"
+}
+
+// MarshalJSON 输出为排序之后的数组
+func (s Set[T]) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("null"), nil
+	}
+	return textUtils.JsonMarshalToBytes(s.sorted())
+}
+
+// UnmarshalJSON 从数组中读取，重复的元素会被去掉
+func (s *Set[T]) UnmarshalJSON(b []byte) error {
+	var items []T
+	if err := textUtils.JsonUnmarshalFromBytes(b, &items); err != nil {
+		return err
+	}
+	if items == nil {
+		*s = Set[T](nil)
+	} else {
+		*s = NewSet(items...)
+	}
+	return nil
+}
+
+// GormDBDataType gorm db data type
+func (Set[T]) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDBDataType(db)
+}
+
+func (s Set[T]) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	data, _ := s.MarshalJSON()
+	return jsonGormValue(db, data)
+}
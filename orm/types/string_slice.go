@@ -0,0 +1,68 @@
+package types
+
+import (
+	"context"
+	"database/sql/driver"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+type StringSlice []string
+
+func (m *StringSlice) Scan(value any) error {
+	if value == nil {
+		*m = StringSlice(nil)
+		return nil
+	}
+	ba, err := jsonBytes(value)
+	if err != nil {
+		return err
+	}
+
+	var t StringSlice
+	if err = textUtils.JsonUnmarshalFromBytes(ba, &t); err != nil {
+		return err
+	}
+	*m = t
+	return nil
+}
+
+func (m StringSlice) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return textUtils.JsonMarshal(m)
+}
+
+// GormDataType gorm common data type
+func (StringSlice) GormDataType() string {
+	return "string_slice"
+}
+
+// MarshalJSON to output non base64 encoded []byte
+func (m StringSlice) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+	return textUtils.JsonMarshalToBytes(([]string)(m))
+}
+
+// UnmarshalJSON to deserialize []byte
+func (m *StringSlice) UnmarshalJSON(b []byte) error {
+	var t []string
+	err := textUtils.JsonUnmarshalFromBytes(b, &t)
+	*m = t
+	return err
+}
+
+// GormDBDataType gorm db data type
+func (StringSlice) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonDBDataType(db)
+}
+
+func (m StringSlice) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	data, _ := m.MarshalJSON()
+	return jsonGormValue(db, data)
+}
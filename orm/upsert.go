@@ -0,0 +1,214 @@
+package orm
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+)
+
+// UpsertResult UpsertModels 的结果
+type UpsertResult struct {
+	Total int64
+	// Inserted、Updated 只有 Counted 为true时有效，统计方式见 WithUpsertCount
+	Inserted int64
+	Updated  int64
+	Counted  bool
+	Chunks   int
+}
+
+type upsertOptions struct {
+	batchSize        int
+	chunkTransaction bool
+	count            bool
+	omitColumns      []string
+}
+
+type UpsertOption func(o *upsertOptions)
+
+// WithUpsertBatchSize 每个语句的行数，默认1000，避免超过MySQL的 max_allowed_packet
+func WithUpsertBatchSize(batchSize int) UpsertOption {
+	return func(o *upsertOptions) {
+		o.batchSize = batchSize
+	}
+}
+
+// WithUpsertChunkTransaction 每个chunk在一个事务中执行
+func WithUpsertChunkTransaction(enabled bool) UpsertOption {
+	return func(o *upsertOptions) {
+		o.chunkTransaction = enabled
+	}
+}
+
+// WithUpsertCount 是否统计 Inserted/Updated，默认为true，只支持MySQL和PostgreSQL，其它数据库的 UpsertResult.Counted 为false
+//
+//	PostgreSQL：使用 RETURNING (xmax = 0) 判断每一行是否为插入，冲突但是值没有变化的行也计为Updated
+//	MySQL：按照affected rows计算（插入为1，修改为2）。值没有变化的行affected rows为0，需要在DSN中加上 clientFoundRows=true，
+//	此时为1，计为Inserted；否则存在值没有变化的行时，Inserted 和 Updated 都不准确
+func WithUpsertCount(enabled bool) UpsertOption {
+	return func(o *upsertOptions) {
+		o.count = enabled
+	}
+}
+
+// WithUpsertOmit 插入时忽略的列
+func WithUpsertOmit(columns ...string) UpsertOption {
+	return func(o *upsertOptions) {
+		o.omitColumns = columns
+	}
+}
+
+// UpsertModels 分批插入models（slice），conflictColumns冲突时（MySQL为唯一键冲突，忽略conflictColumns）修改updateColumns，
+// updateColumns为空时修改除了主键之外的所有列。MySQL为 ON DUPLICATE KEY UPDATE，PostgreSQL、SQLite为 ON CONFLICT DO UPDATE
+//
+//	o.UpsertModels(users, []string{"email"}, []string{"name", "updated_at"}, orm.WithUpsertBatchSize(500))
+//
+// 出错时返回已经完成的chunk的结果，没有开启 WithUpsertChunkTransaction 时，出错的chunk可能已经部分写入
+func (o *QuickOrm) UpsertModels(models any, conflictColumns []string, updateColumns []string, options ...UpsertOption) (*UpsertResult, error) {
+	opts := &upsertOptions{batchSize: 1000, count: true}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.batchSize <= 0 {
+		opts.batchSize = 1000
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(models))
+	if rv.Kind() != reflect.Slice {
+		return nil, errors.Errorf("models must be a slice, but got %T", models)
+	}
+
+	onConflict := clause.OnConflict{UpdateAll: len(updateColumns) == 0}
+	for _, column := range conflictColumns {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+	}
+	if len(updateColumns) > 0 {
+		onConflict.DoUpdates = clause.AssignmentColumns(updateColumns)
+	}
+
+	dialect := o.DB.Dialector.Name()
+	counted := opts.count && (dialect == DriverMySql || dialect == DriverPostgres)
+	var sch *schema.Schema
+	if counted && dialect == DriverPostgres {
+		var err error
+		if sch, err = parseSchema(o.DB, models); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &UpsertResult{Counted: counted}
+	for start := 0; start < rv.Len(); start += opts.batchSize {
+		end := start + opts.batchSize
+		if end > rv.Len() {
+			end = rv.Len()
+		}
+		chunk := rv.Slice(start, end)
+		n := int64(chunk.Len())
+
+		var inserted int64
+		fn := func(db *gorm.DB) error {
+			db = db.Omit(opts.omitColumns...).Clauses(onConflict)
+			if counted && dialect == DriverPostgres {
+				var err error
+				inserted, err = o.upsertReturning(db, sch, chunk)
+				return err
+			}
+
+			res := db.Create(chunk.Interface())
+			if res.Error != nil {
+				return errors.WithStack(res.Error)
+			}
+			if counted { // MySQL
+				inserted = n - mysqlUpsertUpdated(n, res.RowsAffected)
+			}
+			return nil
+		}
+
+		var err error
+		if opts.chunkTransaction {
+			err = o.DB.Transaction(fn)
+		} else {
+			err = fn(o.DB)
+		}
+		if err != nil {
+			return result, errors.WithMessagef(err, "upsert rows %d~%d", start, end)
+		}
+
+		result.Chunks++
+		result.Total += n
+		if counted {
+			result.Inserted += inserted
+			result.Updated += n - inserted
+		}
+	}
+	return result, nil
+}
+
+// mysqlUpsertUpdated 按照MySQL的affected rows（插入为1，修改为2）计算修改的行数
+func mysqlUpsertUpdated(n, rowsAffected int64) int64 {
+	updated := rowsAffected - n
+	if updated < 0 { // 没有开启clientFoundRows，值没有变化的行为0
+		updated = 0
+	} else if updated > n {
+		updated = n
+	}
+	return updated
+}
+
+// upsertReturning PostgreSQL中执行upsert，通过 RETURNING (xmax = 0) 统计插入的行数，同时回填主键。
+// gorm的Create无法读取RETURNING中的表达式，所以先生成SQL（会执行Create的callback，比如BeforeCreate），再直接执行
+func (o *QuickOrm) upsertReturning(db *gorm.DB, sch *schema.Schema, chunk reflect.Value) (int64, error) {
+	columns := make([]clause.Column, 0, len(sch.PrimaryFields)+1)
+	for _, field := range sch.PrimaryFields {
+		columns = append(columns, clause.Column{Name: field.DBName})
+	}
+	columns = append(columns, clause.Column{Name: "(xmax = 0)", Raw: true})
+
+	stmt := db.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true}).Clauses(clause.Returning{Columns: columns}).Create(chunk.Interface()).Statement
+	if stmt.Error != nil {
+		return 0, errors.WithStack(stmt.Error)
+	}
+	rows, err := db.Session(&gorm.Session{NewDB: true}).Raw(stmt.SQL.String(), stmt.Vars...).Rows()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	ctx := db.Statement.Context
+	var inserted int64
+	// 返回的行与插入的顺序相同（gorm回填自增主键时也是如此）
+	for i := 0; rows.Next(); i++ {
+		values := make([]any, len(columns))
+		for j, field := range sch.PrimaryFields {
+			values[j] = reflect.New(field.FieldType).Interface()
+		}
+		var isInserted bool
+		values[len(values)-1] = &isInserted
+		if err = rows.Scan(values...); err != nil {
+			return inserted, errors.WithStack(err)
+		}
+		if isInserted {
+			inserted++
+		}
+		if i < chunk.Len() {
+			elem := reflect.Indirect(chunk.Index(i))
+			for j, field := range sch.PrimaryFields {
+				if err = field.Set(ctx, elem, reflect.ValueOf(values[j]).Elem().Interface()); err != nil {
+					return inserted, errors.WithStack(err)
+				}
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return inserted, errors.WithStack(err)
+	}
+
+	// 直接执行的SQL不会触发 ModelCache 的callback
+	if cache, ok := db.Config.Plugins[modelCachePluginName].(*ModelCache); ok {
+		if err = cache.InvalidateModel(db, reflect.New(sch.ModelType).Interface()); err != nil {
+			cache.logger.Errorf("[ORM]invalidate cache of %s: %s", sch.Table, err.Error())
+		}
+	}
+	return inserted, nil
+}
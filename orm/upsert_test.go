@@ -0,0 +1,57 @@
+package orm
+
+import (
+	"fmt"
+	"testing"
+)
+
+type testMember struct {
+	ID    uint
+	Email string `gorm:"size:64;uniqueIndex"`
+	Name  string
+}
+
+func TestUpsertModels(t *testing.T) {
+	o := newTestSqlite(t)
+	if err := o.DB.AutoMigrate(&testMember{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var members []testMember
+	for i := 0; i < 5; i++ {
+		members = append(members, testMember{Email: fmt.Sprintf("%d@a.com", i), Name: "a"})
+	}
+	if _, err := o.UpsertModels(members[:3], []string{"email"}, []string{"name"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range members {
+		members[i].ID, members[i].Name = 0, "b"
+	}
+	result, err := o.UpsertModels(members, []string{"email"}, []string{"name"}, WithUpsertBatchSize(2), WithUpsertChunkTransaction(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SQLite无法统计 Inserted/Updated
+	if *result != (UpsertResult{Total: 5, Chunks: 3}) {
+		t.Errorf("result: %+v", result)
+	}
+	if c, _ := o.GetCount(&testMember{}, Where{"name": "b"}); c != 5 {
+		t.Errorf("updated rows: %d", c)
+	}
+}
+
+func TestMysqlUpsertUpdated(t *testing.T) {
+	for _, c := range []struct {
+		n, rowsAffected, updated int64
+	}{
+		{3, 3, 0}, // 全部插入
+		{3, 6, 3}, // 全部修改
+		{3, 4, 1}, // 插入（或者clientFoundRows时值没有变化）2行，修改1行
+		{3, 0, 0}, // 没有开启clientFoundRows，值都没有变化
+	} {
+		if updated := mysqlUpsertUpdated(c.n, c.rowsAffected); updated != c.updated {
+			t.Errorf("n: %d, rows affected: %d, updated: %d, expected %d", c.n, c.rowsAffected, updated, c.updated)
+		}
+	}
+}
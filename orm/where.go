@@ -0,0 +1,147 @@
+package orm
+
+import (
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
+)
+
+// Or 条件组，组内的每个 Where 用 OR 连接，作为 Where 的值使用，key 只用于区分，比如 "$or"
+//
+//	Where{"status": 1, "$or": Or{Where{"age >": 60}, Where{"vip": true}}} // status = 1 AND (age > 60 OR vip = true)
+type Or []Where
+
+// And 条件组，组内的每个 Where 用 AND 连接，一般嵌套在 Or 中使用
+//
+//	Or{Where{"$and": And{Where{"age >=": 18}, Where{"age <": 60}}}, Where{"vip": true}}
+type And []Where
+
+// whereOperators key中支持的操作符 => SQL
+var whereOperators = map[string]string{
+	"=":           "= ?",
+	"!=":          "<> ?",
+	"<>":          "<> ?",
+	">":           "> ?",
+	">=":          ">= ?",
+	"<":           "< ?",
+	"<=":          "<= ?",
+	"in":          "IN ?",
+	"not in":      "NOT IN ?",
+	"like":        "LIKE ?",
+	"not like":    "NOT LIKE ?",
+	"between":     "BETWEEN ? AND ?",
+	"not between": "NOT BETWEEN ? AND ?",
+	"is null":     "IS NULL",
+	"is not null": "IS NOT NULL",
+}
+
+// whereSchema 返回db中Model的schema，用于校验字段，没有Model时不校验
+func whereSchema(db *gorm.DB) *schema.Schema {
+	if db.Statement.Model == nil {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(db.Statement.Model); err != nil {
+		return nil
+	}
+	return stmt.Schema
+}
+
+// checkColumn 字段必须是model的字段，带有其它表名前缀的（比如JOIN）不校验
+func checkColumn(sch *schema.Schema, column string) error {
+	if sch == nil {
+		return nil
+	}
+	column = strings.ReplaceAll(column, "`", "")
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		if column[:i] != sch.Table {
+			return nil
+		}
+		column = column[i+1:]
+	}
+	if sch.LookUpField(column) == nil {
+		return errors.Errorf("unknown column \"%s\" of %s", column, sch.Name)
+	}
+	return nil
+}
+
+// buildCondition 将一个 key: value 转换为 db.Where 的参数
+//
+//	"name": "abc"            => name = 'abc'
+//	"age >": 18              => age > 18
+//	"status in": []int{1, 2} => status IN (1, 2)
+//	"created_at between": []time.Time{a, b} => created_at BETWEEN a AND b
+//	"deleted_at is null": nil => deleted_at IS NULL
+//	"a > ? OR b < ?": []any{1, 2} => 包含 ? 的key是原始表达式，不校验字段
+//	"$or": Or{...} / "$and": And{...} => 条件组
+func (o *QuickOrm) buildCondition(db *gorm.DB, sch *schema.Schema, key string, value any) (any, []any, error) {
+	switch v := value.(type) {
+	case Or:
+		return o.buildGroup(db, sch, []Where(v), true)
+	case And:
+		return o.buildGroup(db, sch, []Where(v), false)
+	}
+
+	if strings.Contains(key, "?") { // 包含 ? 则说明k 是完整的表达式
+		if args, ok := value.([]any); ok && strings.Count(key, "?") > 1 {
+			return key, args, nil
+		}
+		return key, []any{value}, nil
+	}
+
+	column, op := key, "="
+	if i := strings.IndexAny(key, " \t"); i >= 0 {
+		column, op = key[:i], strings.ToLower(strings.Join(strings.Fields(key[i:]), " "))
+	}
+	expr, ok := whereOperators[op]
+	if !ok {
+		return nil, nil, errors.Errorf("unknown operator \"%s\" of where \"%s\"", op, key)
+	}
+	if err := checkColumn(sch, column); err != nil {
+		return nil, nil, err
+	}
+
+	switch op {
+	case "is null", "is not null":
+		return column + " " + expr, nil, nil
+	case "between", "not between":
+		rv := reflect.ValueOf(value)
+		if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Len() != 2 {
+			return nil, nil, errors.Errorf("the value of where \"%s\" must be a slice of 2 elements", key)
+		}
+		return column + " " + expr, []any{rv.Index(0).Interface(), rv.Index(1).Interface()}, nil
+	}
+	return column + " " + expr, []any{value}, nil
+}
+
+// buildGroup 生成 (a AND b) OR (c) 形式的条件组
+func (o *QuickOrm) buildGroup(db *gorm.DB, sch *schema.Schema, wheres []Where, or bool) (any, []any, error) {
+	group := db.Session(&gorm.Session{NewDB: true})
+	n := 0
+	for _, w := range wheres {
+		if len(w) == 0 {
+			continue
+		}
+		n++
+		sub := db.Session(&gorm.Session{NewDB: true})
+		for k, v := range w {
+			query, args, err := o.buildCondition(db, sch, k, v)
+			if err != nil {
+				return nil, nil, err
+			} else if query != nil {
+				sub = sub.Where(query, args...)
+			}
+		}
+		if or {
+			group = group.Or(sub)
+		} else {
+			group = group.Where(sub)
+		}
+	}
+	if n == 0 { // 空的条件组
+		return nil, nil, nil
+	}
+	return group, nil, nil
+}
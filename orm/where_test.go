@@ -0,0 +1,93 @@
+package orm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWhereOperators(t *testing.T) {
+	o := newTestSqlite(t)
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := o.CreateModel(&testSite{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := o.DB.Model(&testSite{})
+	sch := whereSchema(db)
+	tests := []struct {
+		key   string
+		value any
+		query string
+		args  []any
+		count int64
+	}{
+		{"name", "a", "name = ?", []any{"a"}, 1},
+		{"name =", "a", "name = ?", []any{"a"}, 1},
+		{"name !=", "a", "name <> ?", []any{"a"}, 2},
+		{"name <>", "a", "name <> ?", []any{"a"}, 2},
+		{"id >", 1, "id > ?", []any{1}, 2},
+		{"id >=", 1, "id >= ?", []any{1}, 3},
+		{"id <", 3, "id < ?", []any{3}, 2},
+		{"id <=", 3, "id <= ?", []any{3}, 3},
+		{"id in", []int{1, 2}, "id IN ?", []any{[]int{1, 2}}, 2},
+		{"id not in", []int{1, 2}, "id NOT IN ?", []any{[]int{1, 2}}, 1},
+		{"name like", "a%", "name LIKE ?", []any{"a%"}, 1},
+		{"name not like", "a%", "name NOT LIKE ?", []any{"a%"}, 2},
+		{"id between", []int{1, 2}, "id BETWEEN ? AND ?", []any{1, 2}, 2},
+		{"id not between", [2]int{1, 2}, "id NOT BETWEEN ? AND ?", []any{1, 2}, 1},
+		{"name is null", nil, "name IS NULL", nil, 0},
+		{"name is not null", nil, "name IS NOT NULL", nil, 3},
+		// 大小写、多余的空白
+		{"id  NOT\tIN", []int{1}, "id NOT IN ?", []any{[]int{1}}, 2},
+		// 带表名
+		{"test_sites.id", 1, "test_sites.id = ?", []any{1}, 1},
+		// 原始表达式
+		{"id > ? AND id < ?", []any{1, 3}, "id > ? AND id < ?", []any{1, 3}, 1},
+		{"name = ?", "b", "name = ?", []any{"b"}, 1},
+	}
+	for _, tt := range tests {
+		query, args, err := o.buildCondition(db, sch, tt.key, tt.value)
+		if err != nil {
+			t.Errorf("%q: %v", tt.key, err)
+			continue
+		}
+		if query != tt.query || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%q: got %v %v, expected %v %v", tt.key, query, args, tt.query, tt.args)
+		}
+		if n, err := o.GetCount(&testSite{}, Where{tt.key: tt.value}); err != nil || n != tt.count {
+			t.Errorf("%q: count %d, %v, expected %d", tt.key, n, err, tt.count)
+		}
+	}
+}
+
+func TestWhereMalformed(t *testing.T) {
+	o := newTestSqlite(t)
+	db := o.DB.Model(&testSite{})
+	sch := whereSchema(db)
+	tests := []struct {
+		key   string
+		value any
+	}{
+		{"name ==", "a"},                 // 未知的操作符
+		{"name regexp", "a"},             // 未知的操作符
+		{"unknown", 1},                   // 未知的字段
+		{"test_sites.unknown", 1},        // 带表名的未知字段
+		{"id between", 1},                // between 的值必须是2个元素的slice
+		{"id between", []int{1, 2, 3}},   // between 的值必须是2个元素的slice
+		{"$or", Or{Where{"unknown": 1}}}, // 条件组中的错误
+	}
+	for _, tt := range tests {
+		if _, _, err := o.buildCondition(db, sch, tt.key, tt.value); err == nil {
+			t.Errorf("%q: expected error", tt.key)
+		}
+		if _, err := o.GetCount(&testSite{}, Where{tt.key: tt.value}); err == nil {
+			t.Errorf("%q: expected query error", tt.key)
+		}
+	}
+
+	// 其它表的字段（比如JOIN）不校验
+	if _, _, err := o.buildCondition(db, sch, "users.unknown", 1); err != nil {
+		t.Errorf("column of other table: %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/go-mixed/go-common.v1/boltdb.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"time"
+)
+
+// BoltBroker 基于BoltDB的 IBroker，适用于单机（单进程）使用
+//
+//	bucket下有5个子bucket：
+//	jobs        id => job
+//	scheduled   RunAt(8字节UnixNano) + id => id
+//	processing  id => 领取的截止时间(8字节UnixNano)
+//	dead        进入死信的时间(8字节UnixNano) + id => id
+//	queued      id => 在scheduled或dead中的key，保证一个任务只有一个等待（或死信）的key
+type BoltBroker struct {
+	bucket *boltdb.BoltBucket
+}
+
+var _ IBroker = (*BoltBroker)(nil)
+
+var (
+	boltJobsBucket       = []byte("jobs")
+	boltScheduledBucket  = []byte("scheduled")
+	boltProcessingBucket = []byte("processing")
+	boltDeadBucket       = []byte("dead")
+	boltQueuedBucket     = []byte("queued")
+)
+
+// NewBoltBroker 任务保存在bucket中，比如 bolt.NestedBucket("queue", "default")
+func NewBoltBroker(bucket *boltdb.BoltBucket) *BoltBroker {
+	return &BoltBroker{bucket: bucket}
+}
+
+func timeKey(t time.Time, id string) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return append(key, id...)
+}
+
+func encodeTime(t time.Time) []byte {
+	return timeKey(t, "")
+}
+
+func decodeTime(buf []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(buf[:8])))
+}
+
+// boltBuckets 一个事务中的子bucket
+type boltBuckets struct {
+	jobs, scheduled, processing, dead, queued *bolt.Bucket
+}
+
+// update 在事务中获取（或创建）所有的子bucket
+func (b *BoltBroker) update(callback func(q *boltBuckets) error) error {
+	return b.bucket.Update(func(bucket *bolt.Bucket) error {
+		var buckets [5]*bolt.Bucket
+		for i, name := range [][]byte{boltJobsBucket, boltScheduledBucket, boltProcessingBucket, boltDeadBucket, boltQueuedBucket} {
+			child, err := bucket.CreateBucketIfNotExists(name)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			buckets[i] = child
+		}
+		return callback(&boltBuckets{jobs: buckets[0], scheduled: buckets[1], processing: buckets[2], dead: buckets[3], queued: buckets[4]})
+	})
+}
+
+// getJob 读取任务，不存在（已被删除）时返回nil
+func (q *boltBuckets) getJob(id []byte) (*Job, error) {
+	buf := q.jobs.Get(id)
+	if buf == nil {
+		return nil, nil
+	}
+	var job Job
+	if err := textUtils.JsonUnmarshalFromBytes(buf, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (q *boltBuckets) putJob(job *Job) error {
+	buf, err := textUtils.JsonMarshalToBytes(job)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(q.jobs.Put([]byte(job.ID), buf))
+}
+
+// enqueue 将任务放入target（scheduled或dead），并删除任务之前的key。
+// 任务超时被重新放入scheduled之后，原来的worker仍然可能 Retry/Dead，不删除的话任务会有两个key，被执行两次
+func (q *boltBuckets) enqueue(target *bolt.Bucket, t time.Time, id []byte) error {
+	if err := q.unqueue(id); err != nil {
+		return err
+	}
+	key := timeKey(t, string(id))
+	if err := target.Put(key, id); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(q.queued.Put(id, key))
+}
+
+// unqueue 删除任务在scheduled、dead中的key
+func (q *boltBuckets) unqueue(id []byte) error {
+	key := q.queued.Get(id)
+	if key == nil {
+		return nil
+	}
+	key = append([]byte(nil), key...)
+	if err := q.scheduled.Delete(key); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := q.dead.Delete(key); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(q.queued.Delete(id))
+}
+
+func (b *BoltBroker) Enqueue(job *Job) error {
+	return b.update(func(q *boltBuckets) error {
+		if err := q.putJob(job); err != nil {
+			return err
+		}
+		return q.enqueue(q.scheduled, job.RunAt, []byte(job.ID))
+	})
+}
+
+func (b *BoltBroker) Claim(now time.Time, limit int, visibility time.Duration) ([]*Job, error) {
+	var res []*Job
+	err := b.update(func(q *boltBuckets) error {
+		// 超时未完成的任务计为失败一次，移回scheduled或者死信
+		var expired [][]byte
+		if err := q.processing.ForEach(func(id, deadline []byte) error {
+			if !decodeTime(deadline).After(now) {
+				expired = append(expired, append([]byte(nil), id...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, id := range expired {
+			if err := q.processing.Delete(id); err != nil {
+				return err
+			}
+			job, err := q.getJob(id)
+			if err != nil {
+				return err
+			} else if job == nil { // 任务已被删除
+				continue
+			}
+			job.Attempts++
+			job.LastError = errVisibilityTimeout
+			if err = q.putJob(job); err != nil {
+				return err
+			}
+
+			target := q.scheduled
+			if job.Attempts > job.MaxRetries {
+				target = q.dead
+			}
+			if err = q.enqueue(target, now, id); err != nil {
+				return err
+			}
+		}
+
+		// 领取到期的任务，遍历时不能删除，先收集
+		var keys, ids [][]byte
+		end := encodeTime(now)
+		c := q.scheduled.Cursor()
+		for k, id := c.First(); k != nil && len(keys) < limit && bytes.Compare(k[:8], end) <= 0; k, id = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+			ids = append(ids, append([]byte(nil), id...))
+		}
+
+		deadline := encodeTime(now.Add(visibility))
+		for i, k := range keys {
+			if err := q.scheduled.Delete(k); err != nil {
+				return err
+			} else if err = q.unqueue(ids[i]); err != nil {
+				return err
+			}
+			job, err := q.getJob(ids[i])
+			if err != nil {
+				return err
+			} else if job == nil { // 任务已被删除
+				continue
+			}
+			if err = q.processing.Put(ids[i], deadline); err != nil {
+				return err
+			}
+			res = append(res, job)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (b *BoltBroker) Ack(job *Job) error {
+	return b.update(func(q *boltBuckets) error {
+		id := []byte(job.ID)
+		if err := q.processing.Delete(id); err != nil {
+			return err
+		} else if err = q.unqueue(id); err != nil {
+			return err
+		}
+		return q.jobs.Delete(id)
+	})
+}
+
+func (b *BoltBroker) Retry(job *Job) error {
+	return b.update(func(q *boltBuckets) error {
+		if err := q.processing.Delete([]byte(job.ID)); err != nil {
+			return err
+		}
+		if err := q.putJob(job); err != nil {
+			return err
+		}
+		return q.enqueue(q.scheduled, job.RunAt, []byte(job.ID))
+	})
+}
+
+func (b *BoltBroker) Dead(job *Job) error {
+	return b.update(func(q *boltBuckets) error {
+		if err := q.processing.Delete([]byte(job.ID)); err != nil {
+			return err
+		}
+		if err := q.putJob(job); err != nil {
+			return err
+		}
+		return q.enqueue(q.dead, time.Now(), []byte(job.ID))
+	})
+}
+
+func (b *BoltBroker) DeadJobs(limit int) ([]*Job, error) {
+	var res []*Job
+	err := b.update(func(q *boltBuckets) error {
+		c := q.dead.Cursor()
+		for k, id := c.First(); k != nil && len(res) < limit; k, id = c.Next() {
+			job, err := q.getJob(id)
+			if err != nil {
+				return err
+			} else if job != nil {
+				res = append(res, job)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// Len 返回等待中、处理中、死信的任务数量
+func (b *BoltBroker) Len() (scheduled, processing, dead int64, err error) {
+	err = b.update(func(q *boltBuckets) error {
+		scheduled = int64(q.scheduled.Stats().KeyN)
+		processing = int64(q.processing.Stats().KeyN)
+		dead = int64(q.dead.Stats().KeyN)
+		return nil
+	})
+	return
+}
@@ -0,0 +1,27 @@
+module gopkg.in/go-mixed/go-common.v1/queue.v1
+
+go 1.19
+
+require (
+	github.com/pkg/errors v0.9.1
+	github.com/redis/go-redis/v9 v9.4.0
+	go.etcd.io/bbolt v1.3.6
+	gopkg.in/go-mixed/go-common.v1 v1.0.0-20231010110122-d23aa8aff7b1
+	gopkg.in/go-mixed/go-common.v1/boltdb.v1 v1.0.0-20231010110122-d23aa8aff7b1
+	gopkg.in/go-mixed/go-common.v1/redis.v1 v1.0.0-20231010110122-d23aa8aff7b1
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/patrickmn/go-cache v2.1.0+incompatible // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/multierr v1.9.0 // indirect
+	golang.org/x/exp v0.0.0-20240119083558-1b970713d09a // indirect
+	golang.org/x/sys v0.4.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	gopkg.in/go-mixed/go-common.v1/cache.v1 v1.0.0-20231010110122-d23aa8aff7b1 // indirect
+)
@@ -0,0 +1,320 @@
+package queue
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"math"
+	"sync"
+	"time"
+)
+
+// errVisibilityTimeout 任务超过 WithVisibilityTimeout 还没有完成时的LastError
+const errVisibilityTimeout = "visibility timeout"
+
+type Job struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Payload    []byte    `json:"payload"`
+	RunAt      time.Time `json:"run_at"`
+	Attempts   int       `json:"attempts"`    // 已经失败的次数
+	MaxRetries int       `json:"max_retries"` // 失败之后最多重试的次数，超过之后进入死信
+	LastError  string    `json:"last_error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// IBroker 任务的存储
+type IBroker interface {
+	// Enqueue 写入任务，在job.RunAt之后可以被领取
+	Enqueue(job *Job) error
+	// Claim 原子的领取最多limit个到期（RunAt <= now）的任务，领取之后的任务在 now+visibility 之前不会被再次领取；
+	// 超过这个时间还没有 Ack/Retry/Dead 的任务（比如进程崩溃）视为失败一次（Attempts+1）：
+	// 未超过 MaxRetries 时作为到期任务重新被领取，否则移入死信
+	Claim(now time.Time, limit int, visibility time.Duration) ([]*Job, error)
+	// Ack 任务完成，删除任务
+	Ack(job *Job) error
+	// Retry 更新任务（Attempts、LastError等），并在job.RunAt之后重新可以被领取
+	Retry(job *Job) error
+	// Dead 将任务移入死信
+	Dead(job *Job) error
+	// DeadJobs 返回最早进入死信的limit个任务
+	DeadJobs(limit int) ([]*Job, error)
+}
+
+// JobHandle 处理任务，返回错误时会按照退避策略重试
+//
+//	ctx不会随 Queue.Run 的ctx取消（停止时会等待正在处理的任务完成），超时为 WithVisibilityTimeout
+type JobHandle interface {
+	Handle(ctx context.Context, job *Job) error
+}
+
+type JobHandleFn func(ctx context.Context, job *Job) error
+
+func (fn JobHandleFn) Handle(ctx context.Context, job *Job) error {
+	return fn(ctx, job)
+}
+
+type Queue struct {
+	broker IBroker
+	logger utils.ILogger
+
+	decoderFunc textUtils.DecoderFunc
+	encoderFunc textUtils.EncoderFunc
+
+	handlers  map[string]JobHandle
+	handlerMu sync.RWMutex
+
+	concurrency       int
+	pollInterval      time.Duration
+	visibilityTimeout time.Duration
+	maxRetries        int
+	backoffBase       time.Duration
+	backoffMax        time.Duration
+}
+
+type QueueOption func(*Queue)
+
+// WithConcurrency 同时处理的任务数，默认10
+func WithConcurrency(concurrency int) QueueOption {
+	return func(q *Queue) {
+		q.concurrency = concurrency
+	}
+}
+
+// WithPollInterval 没有到期任务时，轮询的间隔，默认1s
+func WithPollInterval(interval time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.pollInterval = interval
+	}
+}
+
+// WithVisibilityTimeout 任务被领取之后的处理时限，超时之后会被重新领取（计为失败一次），也是handler的ctx的超时，默认5分钟
+func WithVisibilityTimeout(timeout time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.visibilityTimeout = timeout
+	}
+}
+
+// WithMaxRetries Enqueue时默认的最大重试次数，默认3
+func WithMaxRetries(maxRetries int) QueueOption {
+	return func(q *Queue) {
+		q.maxRetries = maxRetries
+	}
+}
+
+// WithBackoff 重试的指数退避：第n次失败之后等待 base*2^(n-1)，最长max，默认1s~1h
+func WithBackoff(base, max time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.backoffBase = base
+		q.backoffMax = max
+	}
+}
+
+func NewQueue(broker IBroker, logger utils.ILogger, options ...QueueOption) *Queue {
+	q := &Queue{
+		broker:            broker,
+		logger:            logger,
+		encoderFunc:       textUtils.JsonMarshalToBytes,
+		decoderFunc:       textUtils.JsonUnmarshalFromBytes,
+		handlers:          map[string]JobHandle{},
+		concurrency:       10,
+		pollInterval:      time.Second,
+		visibilityTimeout: 5 * time.Minute,
+		maxRetries:        3,
+		backoffBase:       time.Second,
+		backoffMax:        time.Hour,
+	}
+	for _, option := range options {
+		option(q)
+	}
+	return q
+}
+
+func (q *Queue) SetEncoderFunc(encoderFunc textUtils.EncoderFunc) *Queue {
+	q.encoderFunc = encoderFunc
+	return q
+}
+
+func (q *Queue) SetDecoderFunc(decoderFunc textUtils.DecoderFunc) *Queue {
+	q.decoderFunc = decoderFunc
+	return q
+}
+
+// DecodePayload 将job的Payload导出到actual
+func (q *Queue) DecodePayload(job *Job, actual any) error {
+	return q.decoderFunc(job.Payload, actual)
+}
+
+// RegisterHandler 注册jobType的处理函数，重复注册会覆盖
+func (q *Queue) RegisterHandler(jobType string, handle JobHandle) {
+	q.handlerMu.Lock()
+	defer q.handlerMu.Unlock()
+	q.handlers[jobType] = handle
+}
+
+func (q *Queue) handler(jobType string) JobHandle {
+	q.handlerMu.RLock()
+	defer q.handlerMu.RUnlock()
+	return q.handlers[jobType]
+}
+
+type JobOption func(*Job)
+
+// WithJobMaxRetries 本任务的最大重试次数
+func WithJobMaxRetries(maxRetries int) JobOption {
+	return func(job *Job) {
+		job.MaxRetries = maxRetries
+	}
+}
+
+// WithJobID 指定任务的ID，默认随机生成
+func WithJobID(id string) JobOption {
+	return func(job *Job) {
+		job.ID = id
+	}
+}
+
+// Enqueue 写入一个在runAt执行的任务，payload会使用 EncoderFunc 编码，runAt为零值表示立即执行
+func (q *Queue) Enqueue(jobType string, payload any, runAt time.Time, options ...JobOption) (*Job, error) {
+	buf, err := q.encoderFunc(payload)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	now := time.Now()
+	if runAt.IsZero() {
+		runAt = now
+	}
+	job := &Job{
+		ID:         textUtils.GenerateRandomString(20),
+		Type:       jobType,
+		Payload:    buf,
+		RunAt:      runAt,
+		MaxRetries: q.maxRetries,
+		CreatedAt:  now,
+	}
+	for _, option := range options {
+		option(job)
+	}
+
+	if err = q.broker.Enqueue(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// EnqueueIn 写入一个在delay之后执行的任务
+func (q *Queue) EnqueueIn(jobType string, payload any, delay time.Duration, options ...JobOption) (*Job, error) {
+	return q.Enqueue(jobType, payload, time.Now().Add(delay), options...)
+}
+
+func (q *Queue) DeadJobs(limit int) ([]*Job, error) {
+	return q.broker.DeadJobs(limit)
+}
+
+// backoff 第attempts次失败之后的等待时间
+func (q *Queue) backoff(attempts int) time.Duration {
+	d := float64(q.backoffBase) * math.Pow(2, float64(attempts-1))
+	if d > float64(q.backoffMax) {
+		return q.backoffMax
+	}
+	return time.Duration(d)
+}
+
+// Run 阻塞的领取并处理任务，直到ctx结束；ctx结束后会等待正在处理的任务完成
+func (q *Queue) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slots := make(chan struct{}, q.concurrency)
+	for {
+		// 有空闲的slot才领取
+		select {
+		case <-ctx.Done():
+			return nil
+		case slots <- struct{}{}:
+		}
+		free := 1
+	fill:
+		for free < q.concurrency {
+			select {
+			case slots <- struct{}{}:
+				free++
+			default:
+				break fill
+			}
+		}
+
+		jobs, err := q.broker.Claim(time.Now(), free, q.visibilityTimeout)
+		if err != nil {
+			q.logger.Errorf("[Queue]claim jobs error: %s", err.Error())
+		}
+		for i := len(jobs); i < free; i++ {
+			<-slots
+		}
+
+		for _, job := range jobs {
+			wg.Add(1)
+			go func(job *Job) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				q.process(job)
+			}(job)
+		}
+
+		if len(jobs) < free { // 没有更多的到期任务
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(q.pollInterval):
+			}
+		}
+	}
+}
+
+// process 处理任务
+func (q *Queue) process(job *Job) {
+	var err error
+	if handle := q.handler(job.Type); handle == nil {
+		err = errors.Errorf("no handler of job type \"%s\"", job.Type)
+		job.MaxRetries = 0 // 没有handler，重试也没有意义
+	} else {
+		// 不使用runCtx，停止时正在处理的任务不会被取消
+		ctx, cancel := context.WithTimeout(context.Background(), q.visibilityTimeout)
+		err = q.handle(ctx, handle, job)
+		cancel()
+	}
+
+	if err == nil {
+		if err = q.broker.Ack(job); err != nil {
+			q.logger.Errorf("[Queue]ack job %s error: %s", job.ID, err.Error())
+		}
+		return
+	}
+
+	job.Attempts++
+	job.LastError = err.Error()
+	if job.Attempts > job.MaxRetries {
+		q.logger.Errorf("[Queue]job %s(%s) dead after %d attempts: %s", job.ID, job.Type, job.Attempts, err.Error())
+		if err = q.broker.Dead(job); err != nil {
+			q.logger.Errorf("[Queue]move job %s to dead error: %s", job.ID, err.Error())
+		}
+		return
+	}
+
+	job.RunAt = time.Now().Add(q.backoff(job.Attempts))
+	q.logger.Warnf("[Queue]job %s(%s) failed, retry at %s: %s", job.ID, job.Type, job.RunAt.Format(time.RFC3339), err.Error())
+	if err = q.broker.Retry(job); err != nil {
+		q.logger.Errorf("[Queue]retry job %s error: %s", job.ID, err.Error())
+	}
+}
+
+func (q *Queue) handle(ctx context.Context, handle JobHandle, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panic: %v", r)
+		}
+	}()
+	return handle.Handle(ctx, job)
+}
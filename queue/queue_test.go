@@ -0,0 +1,215 @@
+package queue
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/boltdb.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestBroker(t *testing.T) *BoltBroker {
+	b, err := boltdb.NewBolt(t.TempDir()+"/queue.db", utils.NewDefaultLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	return NewBoltBroker(b.NestedBucket("queue", "default"))
+}
+
+func assertLen(t *testing.T, broker *BoltBroker, scheduled, processing, dead int64) {
+	t.Helper()
+	s, p, d, err := broker.Len()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != scheduled || p != processing || d != dead {
+		t.Fatalf("expected scheduled/processing/dead %d/%d/%d, got %d/%d/%d", scheduled, processing, dead, s, p, d)
+	}
+}
+
+// runUntil 运行队列直到cond成立
+func runUntil(t *testing.T, q *Queue, cond func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- q.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			cancel()
+			<-done
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueueAck(t *testing.T) {
+	broker := newTestBroker(t)
+	q := NewQueue(broker, utils.NewDefaultLogger(), WithPollInterval(10*time.Millisecond))
+
+	var got atomic.Value
+	q.RegisterHandler("echo", JobHandleFn(func(ctx context.Context, job *Job) error {
+		var payload string
+		if err := q.DecodePayload(job, &payload); err != nil {
+			return err
+		}
+		got.Store(payload)
+		return nil
+	}))
+	if _, err := q.Enqueue("echo", "hello", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	runUntil(t, q, func() bool { return got.Load() != nil })
+	if got.Load() != "hello" {
+		t.Fatalf("expected payload \"hello\", got %v", got.Load())
+	}
+	assertLen(t, broker, 0, 0, 0)
+}
+
+func TestQueueRetryAndDead(t *testing.T) {
+	broker := newTestBroker(t)
+	q := NewQueue(broker, utils.NewDefaultLogger(),
+		WithPollInterval(10*time.Millisecond), WithMaxRetries(2), WithBackoff(time.Millisecond, time.Millisecond))
+
+	var calls int32
+	q.RegisterHandler("fail", JobHandleFn(func(ctx context.Context, job *Job) error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("failed")
+	}))
+	if _, err := q.Enqueue("fail", nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var dead []*Job
+	runUntil(t, q, func() bool {
+		dead, _ = q.DeadJobs(10)
+		return len(dead) > 0
+	})
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+	if dead[0].Attempts != 3 || dead[0].LastError != "failed" {
+		t.Fatalf("unexpected dead job: %+v", dead[0])
+	}
+	assertLen(t, broker, 0, 0, 1)
+}
+
+func TestBoltBrokerReclaim(t *testing.T) {
+	broker := newTestBroker(t)
+	now := time.Now()
+	if err := broker.Enqueue(&Job{ID: "1", Type: "crash", RunAt: now, MaxRetries: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 领取之后没有Ack（比如进程崩溃），超时之后重新领取时计为失败一次
+	for i := 1; i <= 2; i++ {
+		jobs, err := broker.Claim(now, 10, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(jobs) != 1 {
+			t.Fatalf("claim %d: expected 1 job, got %d", i, len(jobs))
+		} else if jobs[0].Attempts != i-1 {
+			t.Fatalf("claim %d: expected %d attempts, got %d", i, i-1, jobs[0].Attempts)
+		}
+
+		// 超时之前不会被再次领取
+		if jobs, err = broker.Claim(now, 10, time.Second); err != nil {
+			t.Fatal(err)
+		} else if len(jobs) != 0 {
+			t.Fatalf("claim %d: expected no job before visibility timeout, got %d", i, len(jobs))
+		}
+		now = now.Add(time.Second)
+	}
+
+	// 超过MaxRetries之后进入死信
+	jobs, err := broker.Claim(now, 10, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(jobs) != 0 {
+		t.Fatalf("expected no job, got %d", len(jobs))
+	}
+	dead, err := broker.DeadJobs(10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].LastError != errVisibilityTimeout {
+		t.Fatalf("unexpected dead jobs: %+v", dead)
+	}
+	assertLen(t, broker, 0, 0, 1)
+}
+
+func TestBoltBrokerLateRetry(t *testing.T) {
+	broker := newTestBroker(t)
+	now := time.Now()
+	if err := broker.Enqueue(&Job{ID: "1", Type: "slow", RunAt: now, MaxRetries: 3}); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := broker.Claim(now, 10, time.Second)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("claim: %v, %v", jobs, err)
+	}
+
+	// 超时之后任务被重新放入scheduled，原来的worker再Retry/Dead时不能重复放入
+	if _, err = broker.Claim(now.Add(time.Second), 0, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	assertLen(t, broker, 1, 0, 0)
+	late := jobs[0]
+	late.RunAt = now.Add(time.Hour)
+	if err = broker.Retry(late); err != nil {
+		t.Fatal(err)
+	}
+	assertLen(t, broker, 1, 0, 0)
+	if err = broker.Dead(late); err != nil {
+		t.Fatal(err)
+	}
+	assertLen(t, broker, 0, 0, 1)
+	if jobs, err = broker.Claim(now.Add(2*time.Hour), 10, time.Second); err != nil || len(jobs) != 0 {
+		t.Errorf("dead job must not be claimed: %v, %v", jobs, err)
+	}
+}
+
+func TestQueueShutdown(t *testing.T) {
+	broker := newTestBroker(t)
+	q := NewQueue(broker, utils.NewDefaultLogger(), WithPollInterval(10*time.Millisecond))
+
+	started := make(chan struct{})
+	var finished int32
+	q.RegisterHandler("slow", JobHandleFn(func(ctx context.Context, job *Job) error {
+		close(started)
+		// 停止时不会取消正在处理的任务
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+		atomic.StoreInt32(&finished, 1)
+		return nil
+	}))
+	if _, err := q.Enqueue("slow", nil, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- q.Run(ctx) }()
+	<-started
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Fatal("expected the running job to finish before Run returns")
+	}
+	assertLen(t, broker, 0, 0, 0)
+}
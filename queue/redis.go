@@ -0,0 +1,193 @@
+package queue
+
+import (
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	redisCache "gopkg.in/go-mixed/go-common.v1/redis.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"time"
+)
+
+// RedisBroker 基于Redis的 IBroker，多个进程可以同时领取任务
+//
+//	所有的key使用 {prefix} 作为hash tag，在Redis Cluster中位于同一个slot，可以在同一个Lua脚本中操作
+//	{prefix}:jobs        HASH id => job
+//	{prefix}:scheduled   ZSET id, score为RunAt（毫秒）
+//	{prefix}:processing  ZSET id, score为领取的截止时间（毫秒）
+//	{prefix}:dead        ZSET id, score为进入死信的时间（毫秒）
+type RedisBroker struct {
+	redis  *redisCache.Redis
+	prefix string
+}
+
+var _ IBroker = (*RedisBroker)(nil)
+
+// 先将超时未完成的任务计为失败一次，移回scheduled或者死信，再领取到期的任务
+var claimScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], id)
+	local buf = redis.call('HGET', KEYS[3], id)
+	if buf then
+		local job = cjson.decode(buf)
+		job['attempts'] = (job['attempts'] or 0) + 1
+		job['last_error'] = ARGV[4]
+		redis.call('HSET', KEYS[3], id, cjson.encode(job))
+		if job['attempts'] > (job['max_retries'] or 0) then
+			redis.call('ZADD', KEYS[4], ARGV[1], id)
+		else
+			redis.call('ZADD', KEYS[1], ARGV[1], id)
+		end
+	end
+end
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local jobs = {}
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	local job = redis.call('HGET', KEYS[3], id)
+	if job then
+		redis.call('ZADD', KEYS[2], ARGV[3], id)
+		table.insert(jobs, job)
+	end
+end
+return jobs
+`)
+
+// NewRedisBroker prefix为所有key的前缀（hash tag），比如 "queue:default"，key为 "{queue:default}:jobs" 等
+func NewRedisBroker(redis *redisCache.Redis, prefix string) *RedisBroker {
+	return &RedisBroker{
+		redis:  redis,
+		prefix: prefix,
+	}
+}
+
+func (b *RedisBroker) jobsKey() string {
+	return "{" + b.prefix + "}:jobs"
+}
+
+func (b *RedisBroker) scheduledKey() string {
+	return "{" + b.prefix + "}:scheduled"
+}
+
+func (b *RedisBroker) processingKey() string {
+	return "{" + b.prefix + "}:processing"
+}
+
+func (b *RedisBroker) deadKey() string {
+	return "{" + b.prefix + "}:dead"
+}
+
+func (b *RedisBroker) Enqueue(job *Job) error {
+	buf, err := textUtils.JsonMarshalToBytes(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.redis.RedisClient.TxPipelined(b.redis.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(b.redis.Ctx, b.jobsKey(), job.ID, buf)
+		pipe.ZAdd(b.redis.Ctx, b.scheduledKey(), redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+func (b *RedisBroker) Claim(now time.Time, limit int, visibility time.Duration) ([]*Job, error) {
+	res, err := claimScript.Run(b.redis.Ctx, b.redis.RedisClient,
+		[]string{b.scheduledKey(), b.processingKey(), b.jobsKey(), b.deadKey()},
+		now.UnixMilli(), limit, now.Add(visibility).UnixMilli(), errVisibilityTimeout,
+	).StringSlice()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	jobs := make([]*Job, 0, len(res))
+	for _, s := range res {
+		var job Job
+		if err = textUtils.JsonUnmarshal(s, &job); err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (b *RedisBroker) Ack(job *Job) error {
+	_, err := b.redis.RedisClient.TxPipelined(b.redis.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(b.redis.Ctx, b.processingKey(), job.ID)
+		pipe.HDel(b.redis.Ctx, b.jobsKey(), job.ID)
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+func (b *RedisBroker) Retry(job *Job) error {
+	buf, err := textUtils.JsonMarshalToBytes(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.redis.RedisClient.TxPipelined(b.redis.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(b.redis.Ctx, b.processingKey(), job.ID)
+		pipe.HSet(b.redis.Ctx, b.jobsKey(), job.ID, buf)
+		pipe.ZAdd(b.redis.Ctx, b.scheduledKey(), redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+func (b *RedisBroker) Dead(job *Job) error {
+	buf, err := textUtils.JsonMarshalToBytes(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.redis.RedisClient.TxPipelined(b.redis.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(b.redis.Ctx, b.processingKey(), job.ID)
+		pipe.HSet(b.redis.Ctx, b.jobsKey(), job.ID, buf)
+		pipe.ZAdd(b.redis.Ctx, b.deadKey(), redis.Z{Score: float64(time.Now().UnixMilli()), Member: job.ID})
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+func (b *RedisBroker) DeadJobs(limit int) ([]*Job, error) {
+	ids, err := b.redis.RedisClient.ZRange(b.redis.Ctx, b.deadKey(), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	} else if len(ids) == 0 {
+		return nil, nil
+	}
+
+	res, err := b.redis.RedisClient.HMGet(b.redis.Ctx, b.jobsKey(), ids...).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var jobs []*Job
+	for i, v := range res {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var job Job
+		if err = textUtils.JsonUnmarshal(s, &job); err != nil {
+			return jobs, errors.WithMessagef(err, "job %s", ids[i])
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// Len 返回等待中、处理中、死信的任务数量
+func (b *RedisBroker) Len() (scheduled, processing, dead int64, err error) {
+	cmds, err := b.redis.RedisClient.Pipelined(b.redis.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZCard(b.redis.Ctx, b.scheduledKey())
+		pipe.ZCard(b.redis.Ctx, b.processingKey())
+		pipe.ZCard(b.redis.Ctx, b.deadKey())
+		return nil
+	})
+	if err != nil {
+		return 0, 0, 0, errors.WithStack(err)
+	}
+	return cmds[0].(*redis.IntCmd).Val(), cmds[1].(*redis.IntCmd).Val(), cmds[2].(*redis.IntCmd).Val(), nil
+}
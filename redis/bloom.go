@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-mixed/go-common.v1/cache.v1/bloom"
+)
+
+type redisBitStore struct {
+	c *Redis
+}
+
+// BitStore 使用Redis的bitmap（SETBIT/GETBIT）作为布隆过滤器的存储，多个进程可以共享同一个过滤器
+func (c *Redis) BitStore() bloom.IBitStore {
+	return redisBitStore{c: c}
+}
+
+func (s redisBitStore) SetBits(key string, offsets []uint64) error {
+	_, err := s.c.RedisClient.Pipelined(s.c.Ctx, func(pipe redis.Pipeliner) error {
+		for _, offset := range offsets {
+			pipe.SetBit(s.c.Ctx, key, int64(offset), 1)
+		}
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+func (s redisBitStore) TestBits(key string, offsets []uint64) (bool, error) {
+	cmds, err := s.c.RedisClient.Pipelined(s.c.Ctx, func(pipe redis.Pipeliner) error {
+		for _, offset := range offsets {
+			pipe.GetBit(s.c.Ctx, key, int64(offset))
+		}
+		return nil
+	})
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	for _, cmd := range cmds {
+		if cmd.(*redis.IntCmd).Val() == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (s redisBitStore) Incr(key string) (int64, error) {
+	n, err := s.c.RedisClient.Incr(s.c.Ctx, key).Result()
+	return n, errors.WithStack(err)
+}
+
+func (s redisBitStore) Counter(key string) (int64, error) {
+	n, err := s.c.RedisClient.Get(s.c.Ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, errors.WithStack(err)
+}
+
+func (s redisBitStore) Del(keys ...string) error {
+	return errors.WithStack(s.c.RedisClient.Del(s.c.Ctx, keys...).Err())
+}
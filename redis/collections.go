@@ -0,0 +1,334 @@
+package redis
+
+import (
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"gopkg.in/go-mixed/go-common.v1/utils/core"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"reflect"
+	"time"
+)
+
+// 本文件中的方法，写入时都会使用 EncoderFunc 编码，读取时使用 DecoderFunc 导出到actual，如果无需导出, actual 传入nil
+// 在 Batch/Pipelined 的回调中调用时，写入操作会加入pipeline，读取操作在回调中无法得到结果
+
+// Pipelined 即 Batch，只是回调的参数是 *Redis，可以直接调用 HSet/SAdd/ZAdd/LPush 等方法
+func (c *Redis) Pipelined(callback func(r *Redis) error) error {
+	return c.Batch(func(client utils.IKV) error {
+		return callback(client.(*Redis))
+	})
+}
+
+func (c *Redis) encodeAll(values []any) ([]any, error) {
+	bufs := make([]any, 0, len(values))
+	for _, v := range values {
+		buf, err := c.EncoderFunc(v)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		bufs = append(bufs, buf)
+	}
+	return bufs, nil
+}
+
+func (c *Redis) decodeList(list []string, actual any) ([][]byte, error) {
+	bufs := make([][]byte, 0, len(list))
+	for _, s := range list {
+		bufs = append(bufs, []byte(s))
+	}
+	if len(bufs) > 0 && !core.IsNil(actual) {
+		if err := textUtils.ListDecodeAny(c.DecoderFunc, bufs, actual); err != nil {
+			c.Logger.Errorf("[Redis]unmarshal list error: %s", err.Error())
+			return bufs, err
+		}
+	}
+	return bufs, nil
+}
+
+// HSet 写入hash中的一个field
+func (c *Redis) HSet(key string, field string, val any) error {
+	buf, err := c.EncoderFunc(val)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(c.RedisClient.HSet(c.Ctx, key, field, buf).Err())
+}
+
+// HMSet 写入hash中的多个field，values 可以是 map[string]T 或 struct（指针），
+// struct的field名优先使用 `redis:"name"` 的tag，tag为"-"的字段会被忽略
+func (c *Redis) HMSet(key string, values any) error {
+	fields, err := hashFields(values)
+	if err != nil {
+		return err
+	}
+
+	args := make([]any, 0, len(fields)*2)
+	for field, v := range fields {
+		buf, err := c.EncoderFunc(v)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		args = append(args, field, buf)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return errors.WithStack(c.RedisClient.HSet(c.Ctx, key, args...).Err())
+}
+
+// HGet 读取hash中的一个field，不存在时返回nil, nil
+func (c *Redis) HGet(key string, field string, actual any) ([]byte, error) {
+	val, err := c.RedisClient.HGet(c.Ctx, key, field).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !core.IsNil(actual) {
+		if err = c.DecoderFunc(val, actual); err != nil {
+			c.Logger.Errorf("[Redis]unmarshal: %s of error: %s", val, err.Error())
+			return val, errors.WithStack(err)
+		}
+	}
+	return val, nil
+}
+
+// HGetAll 读取hash中的所有field，actual 可以是 *map[string]T 或 struct指针（字段对应规则见 HMSet）
+func (c *Redis) HGetAll(key string, actual any) (map[string][]byte, error) {
+	res, err := c.RedisClient.HGetAll(c.Ctx, key).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	values := make(map[string][]byte, len(res))
+	for field, v := range res {
+		values[field] = []byte(v)
+	}
+
+	if len(values) > 0 && !core.IsNil(actual) {
+		if err = decodeHash(c.DecoderFunc, values, actual); err != nil {
+			c.Logger.Errorf("[Redis]unmarshal hash %s error: %s", key, err.Error())
+			return values, err
+		}
+	}
+	return values, nil
+}
+
+func (c *Redis) HDel(key string, fields ...string) error {
+	return errors.WithStack(c.RedisClient.HDel(c.Ctx, key, fields...).Err())
+}
+
+// SAdd 添加set的成员，相同的值编码之后相同才会被去重
+func (c *Redis) SAdd(key string, members ...any) error {
+	bufs, err := c.encodeAll(members)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(c.RedisClient.SAdd(c.Ctx, key, bufs...).Err())
+}
+
+func (c *Redis) SRem(key string, members ...any) error {
+	bufs, err := c.encodeAll(members)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(c.RedisClient.SRem(c.Ctx, key, bufs...).Err())
+}
+
+func (c *Redis) SIsMember(key string, member any) (bool, error) {
+	buf, err := c.EncoderFunc(member)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	ok, err := c.RedisClient.SIsMember(c.Ctx, key, buf).Result()
+	return ok, errors.WithStack(err)
+}
+
+// SMembers 读取set的所有成员，actual 必须是slice指针
+func (c *Redis) SMembers(key string, actual any) ([][]byte, error) {
+	res, err := c.RedisClient.SMembers(c.Ctx, key).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c.decodeList(res, actual)
+}
+
+type ZMember struct {
+	Score  float64
+	Member any
+}
+
+// ZAdd 添加sorted set的成员
+func (c *Redis) ZAdd(key string, members ...ZMember) error {
+	zs := make([]redis.Z, 0, len(members))
+	for _, m := range members {
+		buf, err := c.EncoderFunc(m.Member)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		zs = append(zs, redis.Z{Score: m.Score, Member: buf})
+	}
+	return errors.WithStack(c.RedisClient.ZAdd(c.Ctx, key, zs...).Err())
+}
+
+func (c *Redis) ZRem(key string, members ...any) error {
+	bufs, err := c.encodeAll(members)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(c.RedisClient.ZRem(c.Ctx, key, bufs...).Err())
+}
+
+// ZRangeByScore 按score从小到大返回 min（含）~max（含）之间的成员及其score，并将成员导出到actual（slice指针）
+//
+//	min、max 支持redis的语法，比如 "-inf"、"+inf"、"(1"；limit为-1表示不限制数量
+func (c *Redis) ZRangeByScore(key string, min, max string, offset, limit int64, actual any) (members [][]byte, scores []float64, err error) {
+	res, err := c.RedisClient.ZRangeByScoreWithScores(c.Ctx, key, &redis.ZRangeBy{
+		Min:    min,
+		Max:    max,
+		Offset: offset,
+		Count:  limit,
+	}).Result()
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	list := make([]string, 0, len(res))
+	for _, z := range res {
+		list = append(list, z.Member.(string))
+		scores = append(scores, z.Score)
+	}
+	members, err = c.decodeList(list, actual)
+	return members, scores, err
+}
+
+// LPush 从左侧写入list
+func (c *Redis) LPush(key string, values ...any) error {
+	bufs, err := c.encodeAll(values)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(c.RedisClient.LPush(c.Ctx, key, bufs...).Err())
+}
+
+// RPush 从右侧写入list
+func (c *Redis) RPush(key string, values ...any) error {
+	bufs, err := c.encodeAll(values)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(c.RedisClient.RPush(c.Ctx, key, bufs...).Err())
+}
+
+// LRange 读取list中start~stop（含）的数据，stop为-1表示到结尾，actual 必须是slice指针
+func (c *Redis) LRange(key string, start, stop int64, actual any) ([][]byte, error) {
+	res, err := c.RedisClient.LRange(c.Ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return c.decodeList(res, actual)
+}
+
+// BRPop 阻塞的从多个list的右侧弹出一个数据，返回数据所在的key；timeout为0表示一直阻塞，超时返回"", nil, nil
+func (c *Redis) BRPop(timeout time.Duration, actual any, keys ...string) (key string, val []byte, err error) {
+	res, err := c.RedisClient.BRPop(c.Ctx, timeout, keys...).Result()
+	if err == redis.Nil {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, errors.WithStack(err)
+	} else if len(res) < 2 {
+		return "", nil, nil
+	}
+
+	key, val = res[0], []byte(res[1])
+	if !core.IsNil(actual) {
+		if err = c.DecoderFunc(val, actual); err != nil {
+			c.Logger.Errorf("[Redis]unmarshal: %s of error: %s", val, err.Error())
+			return key, val, errors.WithStack(err)
+		}
+	}
+	return key, val, nil
+}
+
+// hashFields 将 map[string]T 或 struct 转为 field => value
+func hashFields(values any) (map[string]any, error) {
+	v := reflect.Indirect(reflect.ValueOf(values))
+	fields := map[string]any{}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, errors.Errorf("the key of map must be string, got %s", v.Type().Key())
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			fields[iter.Key().String()] = iter.Value().Interface()
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if name, ok := hashFieldName(t.Field(i)); ok {
+				fields[name] = v.Field(i).Interface()
+			}
+		}
+	default:
+		return nil, errors.Errorf("values must be a map or struct, got %T", values)
+	}
+	return fields, nil
+}
+
+func hashFieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	tag := field.Tag.Get("redis")
+	if tag == "-" {
+		return "", false
+	} else if tag != "" {
+		return tag, true
+	}
+	return field.Name, true
+}
+
+// decodeHash 将 field => value 导出到 *map[string]T 或 struct指针
+func decodeHash(decoderFunc textUtils.DecoderFunc, values map[string][]byte, actual any) error {
+	v := reflect.ValueOf(actual)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.Errorf("actual must be a pointer, got %T", actual)
+	}
+	v = v.Elem()
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return errors.Errorf("the key of map must be string, got %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for field, buf := range values {
+			item := reflect.New(v.Type().Elem())
+			if err := decoderFunc(buf, item.Interface()); err != nil {
+				return errors.WithMessagef(err, "field \"%s\"", field)
+			}
+			v.SetMapIndex(reflect.ValueOf(field).Convert(v.Type().Key()), item.Elem())
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := hashFieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			if buf, ok := values[name]; ok {
+				if err := decoderFunc(buf, v.Field(i).Addr().Interface()); err != nil {
+					return errors.WithMessagef(err, "field \"%s\"", name)
+				}
+			}
+		}
+	default:
+		return errors.Errorf("actual must be a pointer of map or struct, got %T", actual)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package redis
+
+import (
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-mixed/go-common.v1/cache.v1"
+	"gopkg.in/go-mixed/go-common.v1/utils/text"
+	"time"
+)
+
+// 只删除自己持有的锁
+var unlockScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// TryLock 使用 SET NX PX 尝试获取key的锁，ttl之后自动释放；获取成功时返回 true 和解锁函数
+func (c *Redis) TryLock(key string, ttl time.Duration) (unlock func(), ok bool, err error) {
+	token := textUtils.GenerateRandomString(16)
+	ok, err = c.RedisClient.SetNX(c.Ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	} else if !ok {
+		return nil, false, nil
+	}
+
+	return func() {
+		if err := unlockScript.Run(c.Ctx, c.RedisClient, []string{key}, token).Err(); err != nil {
+			c.Logger.Errorf("[Redis]unlock %s error: %s", key, err.Error())
+		}
+	}, true, nil
+}
+
+// DistributedRemember 跨进程的 Remember，只有获得锁的进程会调用loader，详见 cache.DistributedRemember
+func (c *Redis) DistributedRemember(key string, expiration time.Duration, loader func() (any, error), actual any, options ...cache.DistributedOption) ([]byte, error) {
+	return cache.DistributedRemember(c, c, key, expiration, loader, actual, options...)
+}
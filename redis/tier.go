@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/go-mixed/go-common.v1/cache.v1"
+	"time"
+)
+
+type redisTierStore struct {
+	c *Redis
+}
+
+// TierStore 作为 cache.TieredCache 的一级存储，读写的都是原始数据，不经过EncoderFunc/DecoderFunc
+func (c *Redis) TierStore() cache.ITierStore {
+	return redisTierStore{c: c}
+}
+
+func (s redisTierStore) GetBytes(key string) ([]byte, error) {
+	buf, err := s.c.RedisClient.Get(s.c.Ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf, nil
+}
+
+func (s redisTierStore) SetBytes(key string, buf []byte, ttl time.Duration) error {
+	if ttl < 0 { // go-redis中-1表示KeepTTL
+		ttl = 0
+	}
+	return errors.WithStack(s.c.RedisClient.Set(s.c.Ctx, key, buf, ttl).Err())
+}
+
+func (s redisTierStore) Del(key string) error {
+	return s.c.Del(key)
+}
@@ -0,0 +1,71 @@
+package encryptUtils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// AesGcmEncrypt AES-GCM加密，每次随机生成nonce，返回 nonce + 密文（包含认证tag）
+//
+//	key为16、24、32位，分别对应AES-128，AES-192，AES-256
+func AesGcmEncrypt(data []byte, key []byte) ([]byte, error) {
+	gcm, err := newGcm(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// AesGcmDecrypt AES-GCM解密，data为 AesGcmEncrypt 的结果，密钥错误或者数据被修改时返回错误
+func AesGcmDecrypt(data []byte, key []byte) ([]byte, error) {
+	gcm, err := newGcm(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return plain, nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return gcm, nil
+}
+
+// EncryptByAesGcm AES-GCM加密 后 base64
+func EncryptByAesGcm(data, key []byte) (string, error) {
+	res, err := AesGcmEncrypt(data, key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(res), nil
+}
+
+// DecryptByAesGcm base64解码 后 AES-GCM解密
+func DecryptByAesGcm(data string, key []byte) ([]byte, error) {
+	dataByte, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return AesGcmDecrypt(dataByte, key)
+}
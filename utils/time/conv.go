@@ -69,6 +69,14 @@ func (t *AnyTime) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON 零值为""，否则为RFC3339Nano格式，可以被 UnmarshalJSON 还原
+func (t AnyTime) MarshalJSON() ([]byte, error) {
+	if t.ToTime().IsZero() {
+		return []byte(`""`), nil
+	}
+	return json.Marshal(t.ToTime().Format(time.RFC3339Nano))
+}
+
 func (t AnyTime) ToTime() time.Time {
 	return time.Time(t)
 }
@@ -83,8 +91,14 @@ func (t *AnyTime) GobDecode(data []byte) error {
 	return (*time.Time)(t).GobDecode(data)
 }
 
-// Scan for sql decode
+// Scan for sql decode, SQLite等驱动可能返回字符串
 func (t *AnyTime) Scan(value any) error {
+	switch value.(type) {
+	case string, []byte:
+		n, err := NewAnyTime(value)
+		*t = n
+		return err
+	}
 	nullTime := &sql.NullTime{}
 	err := nullTime.Scan(value)
 	*t = AnyTime(nullTime.Time)
@@ -96,7 +110,7 @@ func (t AnyTime) Value() (driver.Value, error) {
 	return t.ToTime(), nil
 }
 
-// GormDataType gorm common data type
+// GormDataType gorm common data type。PostgreSQL没有datetime类型，需要使用 orm/types.AnyTime
 func (t AnyTime) GormDataType() string {
 	return "datetime"
 }
@@ -0,0 +1,26 @@
+package timeUtils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAnyTimeJSON(t *testing.T) {
+	expected := AnyTime(time.Date(2030, 1, 2, 3, 4, 5, 6, time.UTC))
+	buf, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(buf) != `"2030-01-02T03:04:05.000000006Z"` {
+		t.Errorf("marshal: %s", buf)
+	}
+
+	var actual AnyTime
+	if err = json.Unmarshal(buf, &actual); err != nil || !actual.ToTime().Equal(expected.ToTime()) {
+		t.Errorf("unmarshal: %v, %v", actual.ToTime(), err)
+	}
+
+	if buf, _ = json.Marshal(AnyTime{}); string(buf) != `""` {
+		t.Errorf("marshal zero: %s", buf)
+	}
+}
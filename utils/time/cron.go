@@ -0,0 +1,303 @@
+// Copyright (C) 2012 Rob Figueroa
+// All rights reserved.
+//
+// The cron spec parsing and the Next algorithm are adapted from github.com/robfig/cron (spec.go),
+// which is licensed under the MIT License:
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package timeUtils
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 计算t之后下一次运行的时间，没有下一次时返回零值
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// CronSchedule cron表达式，每个字段用bit位表示允许的值
+type CronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	location                              *time.Location
+}
+
+type everySchedule struct {
+	interval time.Duration
+}
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(s.interval - time.Duration(t.Nanosecond())*time.Nanosecond)
+}
+
+// 字段为*或?时设置此位，用于判断日和星期的关系
+const starBit = 1 << 63
+
+type cronField struct {
+	min, max uint
+	names    map[string]uint
+	// sunday7 星期的字段，7和0都表示星期日
+	sunday7 bool
+}
+
+var (
+	secondField = cronField{0, 59, nil, false}
+	minuteField = cronField{0, 59, nil, false}
+	hourField   = cronField{0, 23, nil, false}
+	domField    = cronField{1, 31, nil, false}
+	monthField  = cronField{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}, false}
+	dowField = cronField{0, 6, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}, true}
+)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// ParseCron 解析cron表达式，location为nil时使用time.Local
+//
+//	支持：
+//	1. 6个字段：秒 分 时 日 月 星期；5个字段时省略秒（秒为0）
+//	2. * ? , - / 以及月份、星期的英文缩写（JAN、MON）
+//	3. 以 CRON_TZ=Asia/Shanghai 或 TZ=Asia/Shanghai 开头指定时区
+//	4. @yearly @monthly @weekly @daily @hourly 以及 @every 1h30m
+//	日和星期都不是*时，满足其一即可（与标准cron一致）
+func ParseCron(spec string, location *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if location == nil {
+		location = time.Local
+	}
+
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.Index(spec, " ")
+		if i < 0 {
+			return nil, errors.Errorf("invalid cron spec \"%s\"", spec)
+		}
+		var err error
+		if location, err = time.LoadLocation(spec[strings.Index(spec, "=")+1 : i]); err != nil {
+			return nil, errors.WithMessagef(err, "invalid time zone of cron spec \"%s\"", spec)
+		}
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid cron spec \"%s\"", spec)
+		} else if interval < time.Second {
+			return nil, errors.Errorf("the interval of cron spec \"%s\" must be >= 1s", spec)
+		}
+		return everySchedule{interval: interval}, nil
+	} else if descriptor, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = descriptor
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) == 5 {
+		fields = append([]string{"0"}, fields...)
+	} else if len(fields) != 6 {
+		return nil, errors.Errorf("cron spec \"%s\" must have 5 or 6 fields", spec)
+	}
+
+	s := &CronSchedule{location: location}
+	var err error
+	for i, f := range []struct {
+		bits  *uint64
+		field cronField
+	}{{&s.second, secondField}, {&s.minute, minuteField}, {&s.hour, hourField}, {&s.dom, domField}, {&s.month, monthField}, {&s.dow, dowField}} {
+		if *f.bits, err = parseCronField(fields[i], f.field); err != nil {
+			return nil, errors.WithMessagef(err, "cron spec \"%s\"", spec)
+		}
+	}
+	return s, nil
+}
+
+// parseCronField 解析一个字段，比如 "1-10/2,15,*/5"
+func parseCronField(expr string, field cronField) (uint64, error) {
+	var res uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, step := part, uint(1)
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.ParseUint(part[i+1:], 10, 8)
+			if err != nil || n == 0 {
+				return 0, errors.Errorf("invalid step \"%s\"", part)
+			}
+			rangeExpr, step = part[:i], uint(n)
+		}
+
+		var start, end uint
+		var extra uint64
+		switch {
+		case rangeExpr == "*" || rangeExpr == "?":
+			start, end = field.min, field.max
+			if step == 1 {
+				extra = starBit
+			}
+		case strings.Contains(rangeExpr, "-"):
+			i := strings.Index(rangeExpr, "-")
+			var err error
+			if start, err = parseCronValue(rangeExpr[:i], field); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(rangeExpr[i+1:], field); err != nil {
+				return 0, err
+			}
+		default:
+			n, err := parseCronValue(rangeExpr, field)
+			if err != nil {
+				return 0, err
+			}
+			start, end = n, n
+			if step > 1 { // 比如 5/10 表示从5开始每10个
+				end = field.max
+			}
+		}
+
+		if start > end {
+			return 0, errors.Errorf("invalid range \"%s\"", part)
+		}
+		for n := start; n <= end; n += step {
+			res |= 1 << n
+		}
+		res |= extra
+	}
+	if field.sunday7 && res&(1<<7) > 0 { // 星期日可以写作7，包括范围中的7，比如 5-7
+		res = res&^(1<<7) | 1
+	}
+	return res, nil
+}
+
+func parseCronValue(s string, field cronField) (uint, error) {
+	if n, ok := field.names[strings.ToLower(s)]; ok {
+		return n, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, errors.Errorf("invalid value \"%s\"", s)
+	}
+	if uint(n) < field.min || (uint(n) > field.max && !(field.sunday7 && n == 7)) {
+		return 0, errors.Errorf("value \"%s\" out of range [%d, %d]", s, field.min, field.max)
+	}
+	return uint(n), nil
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom > 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow > 0
+	if s.dom&starBit > 0 || s.dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next 返回t之后（不含t）下一次运行的时间，5年内没有匹配的时间时返回零值
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	origLocation := t.Location()
+	loc := s.location
+	t = t.In(loc)
+
+	// 从下一秒开始
+	t = t.Add(time.Second - time.Duration(t.Nanosecond())*time.Nanosecond)
+	added := false
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		// 夏令时可能导致不是0点
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Minute)
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Second())&s.second == 0 {
+		if !added {
+			added = true
+			t = t.Truncate(time.Second)
+		}
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t.In(origLocation)
+}
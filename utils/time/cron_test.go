@@ -0,0 +1,77 @@
+package timeUtils
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	base := time.Date(2024, 1, 31, 23, 59, 30, 0, time.UTC)
+
+	for _, c := range []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * * *", base.Add(time.Second)},
+		{"0 * * * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * * *", time.Date(2024, 1, 31, 23, 59, 45, 0, time.UTC)},
+		{"0 30 9 * * MON-FRI", time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 29 FEB *", time.Date(2024, 2, 29, 1, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// 星期日可以写作7，包括范围中的7
+		{"0 0 * * 7", time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 6-7", time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-7", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"CRON_TZ=Asia/Shanghai 0 8 * * *", time.Date(2024, 2, 1, 8, 0, 0, 0, shanghai)},
+	} {
+		s, err := ParseCron(c.spec, time.UTC)
+		if err != nil {
+			t.Fatalf("parse \"%s\": %s", c.spec, err)
+		}
+		if got := s.Next(base); !got.Equal(c.want) {
+			t.Errorf("\"%s\" next: %s, want %s", c.spec, got, c.want)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * * *", "* * * * 13", "* * * * 8", "*/0 * * * *", "TZ=Nowhere/City * * * * *"} {
+		if _, err := ParseCron(spec, nil); err == nil {
+			t.Errorf("\"%s\" must be invalid", spec)
+		}
+	}
+}
+
+func TestCronScheduler(t *testing.T) {
+	var count atomic.Int32
+	s := NewCronScheduler(nil)
+	if err := s.AddJob("test", "* * * * * *", func(ctx context.Context) error {
+		count.Add(1)
+		time.Sleep(1500 * time.Millisecond)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3500*time.Millisecond)
+	defer cancel()
+	_ = s.Run(ctx)
+
+	status, _ := s.Job("test")
+	if status.Running != 0 {
+		t.Errorf("running must be 0 after Run returned")
+	}
+	if n := count.Load(); n < 1 || n > 2 {
+		t.Errorf("job must run 1~2 times, got %d", n)
+	}
+	var skipped int
+	for _, run := range status.History {
+		if run.Skipped != "" {
+			skipped++
+		}
+	}
+	if skipped == 0 {
+		t.Errorf("overlapping runs must be skipped")
+	}
+}
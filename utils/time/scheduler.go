@@ -0,0 +1,342 @@
+package timeUtils
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"gopkg.in/go-mixed/go-common.v1/utils"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CronLocker 分布式锁，用于多个副本中只有一个运行任务，比如 redis.Redis、etcd.Etcd
+type CronLocker interface {
+	TryLock(key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
+
+type CronFunc func(ctx context.Context) error
+
+// CronRun 一次运行的记录
+type CronRun struct {
+	ScheduledAt time.Time
+	StartedAt   time.Time
+	Duration    time.Duration
+	Err         error
+	// Skipped 没有运行的原因，比如超过了最大并发数、没有获得锁
+	Skipped string
+}
+
+// CronJobStatus 任务的状态
+type CronJobStatus struct {
+	Name      string
+	Spec      string
+	NextRunAt time.Time
+	LastRunAt time.Time
+	LastError error
+	Running   int
+	History   []CronRun // 从旧到新
+}
+
+type cronJob struct {
+	name     string
+	spec     string
+	schedule Schedule
+	fn       CronFunc
+
+	jitter    time.Duration
+	withLock  bool
+	runningCh chan struct{} // 同时运行的任务，超过之后跳过本次运行
+
+	next      time.Time
+	lastRunAt time.Time
+	lastError error
+	history   []CronRun
+	mu        sync.RWMutex
+}
+
+type CronJobOption func(*cronJob)
+
+// WithCronJitter 在计划时间之后随机延迟[0, jitter)再运行，避免多个任务同时运行
+func WithCronJitter(jitter time.Duration) CronJobOption {
+	return func(j *cronJob) {
+		j.jitter = jitter
+	}
+}
+
+// WithCronMaxConcurrency 本任务同时运行的最大数量，默认1（上一次没有运行完则跳过本次）
+func WithCronMaxConcurrency(n int) CronJobOption {
+	return func(j *cronJob) {
+		if n <= 0 {
+			n = 1
+		}
+		j.runningCh = make(chan struct{}, n)
+	}
+}
+
+// WithoutCronLock 本任务不使用分布式锁，每个副本都会运行
+func WithoutCronLock() CronJobOption {
+	return func(j *cronJob) {
+		j.withLock = false
+	}
+}
+
+// CronScheduler cron任务的调度器
+type CronScheduler struct {
+	logger      utils.ILogger
+	location    *time.Location
+	locker      CronLocker
+	lockTTL     time.Duration
+	lockPrefix  string
+	historySize int
+
+	jobs     map[string]*cronJob
+	jobsMu   sync.RWMutex
+	changeCh chan struct{}
+	wg       sync.WaitGroup
+}
+
+type CronOption func(*CronScheduler)
+
+// WithCronLocation 默认的时区，cron表达式中的 CRON_TZ= 优先，默认 time.Local
+func WithCronLocation(location *time.Location) CronOption {
+	return func(s *CronScheduler) {
+		s.location = location
+	}
+}
+
+// WithCronLocker 使用分布式锁，每次运行之前以 prefix+任务名+计划时间 为key获取锁，获得锁的副本才会运行。
+// 锁不会主动释放，ttl应大于各副本间的时钟误差
+func WithCronLocker(locker CronLocker, prefix string, ttl time.Duration) CronOption {
+	return func(s *CronScheduler) {
+		s.locker = locker
+		s.lockPrefix = prefix
+		s.lockTTL = ttl
+	}
+}
+
+// WithCronHistorySize 每个任务保留的运行记录数，默认10
+func WithCronHistorySize(size int) CronOption {
+	return func(s *CronScheduler) {
+		s.historySize = size
+	}
+}
+
+func NewCronScheduler(logger utils.ILogger, options ...CronOption) *CronScheduler {
+	s := &CronScheduler{
+		logger:      logger,
+		location:    time.Local,
+		lockPrefix:  "cron:",
+		lockTTL:     time.Minute,
+		historySize: 10,
+		jobs:        map[string]*cronJob{},
+		changeCh:    make(chan struct{}, 1),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// AddJob 添加任务，name重复时会替换原任务，spec的格式见 ParseCron
+func (s *CronScheduler) AddJob(name string, spec string, fn CronFunc, options ...CronJobOption) error {
+	schedule, err := ParseCron(spec, s.location)
+	if err != nil {
+		return err
+	}
+
+	job := &cronJob{
+		name:      name,
+		spec:      spec,
+		schedule:  schedule,
+		fn:        fn,
+		withLock:  true,
+		runningCh: make(chan struct{}, 1),
+		next:      schedule.Next(time.Now()),
+	}
+	for _, option := range options {
+		option(job)
+	}
+
+	s.jobsMu.Lock()
+	s.jobs[name] = job
+	s.jobsMu.Unlock()
+	s.notifyChange()
+	return nil
+}
+
+func (s *CronScheduler) RemoveJob(name string) {
+	s.jobsMu.Lock()
+	delete(s.jobs, name)
+	s.jobsMu.Unlock()
+	s.notifyChange()
+}
+
+func (s *CronScheduler) notifyChange() {
+	select {
+	case s.changeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (j *cronJob) status() CronJobStatus {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return CronJobStatus{
+		Name:      j.name,
+		Spec:      j.spec,
+		NextRunAt: j.next,
+		LastRunAt: j.lastRunAt,
+		LastError: j.lastError,
+		Running:   len(j.runningCh),
+		History:   append([]CronRun(nil), j.history...),
+	}
+}
+
+// Job 返回任务的状态
+func (s *CronScheduler) Job(name string) (CronJobStatus, bool) {
+	s.jobsMu.RLock()
+	job, ok := s.jobs[name]
+	s.jobsMu.RUnlock()
+	if !ok {
+		return CronJobStatus{}, false
+	}
+	return job.status(), true
+}
+
+// Jobs 返回所有任务的状态，按名称排序
+func (s *CronScheduler) Jobs() []CronJobStatus {
+	s.jobsMu.RLock()
+	var res []CronJobStatus
+	for _, job := range s.jobs {
+		res = append(res, job.status())
+	}
+	s.jobsMu.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// Run 阻塞的调度任务，直到ctx结束；ctx结束后不再调度新的运行，并等待正在运行的任务完成
+func (s *CronScheduler) Run(ctx context.Context) error {
+	defer s.wg.Wait()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		now := time.Now()
+		next := s.dispatch(ctx, now)
+
+		if next.IsZero() { // 没有任务
+			next = now.Add(time.Hour)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next.Sub(now))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.changeCh:
+		case <-timer.C:
+		}
+	}
+}
+
+// dispatch 运行所有到期的任务，返回最近的下次运行时间
+func (s *CronScheduler) dispatch(ctx context.Context, now time.Time) time.Time {
+	s.jobsMu.RLock()
+	defer s.jobsMu.RUnlock()
+
+	var earliest time.Time
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		if !job.next.IsZero() && !job.next.After(now) {
+			scheduledAt := job.next
+			job.next = job.schedule.Next(now)
+			s.wg.Add(1)
+			go s.run(ctx, job, scheduledAt)
+		}
+		next := job.next
+		job.mu.Unlock()
+
+		if !next.IsZero() && (earliest.IsZero() || next.Before(earliest)) {
+			earliest = next
+		}
+	}
+	return earliest
+}
+
+func (s *CronScheduler) run(ctx context.Context, job *cronJob, scheduledAt time.Time) {
+	defer s.wg.Done()
+
+	select {
+	case job.runningCh <- struct{}{}:
+		defer func() { <-job.runningCh }()
+	default:
+		s.record(job, CronRun{ScheduledAt: scheduledAt, Skipped: "max concurrency reached"})
+		return
+	}
+
+	if job.jitter > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(rand.Int63n(int64(job.jitter)))):
+		}
+	}
+
+	if s.locker != nil && job.withLock {
+		key := s.lockPrefix + job.name + ":" + strconv.FormatInt(scheduledAt.Unix(), 10)
+		_, ok, err := s.locker.TryLock(key, s.lockTTL)
+		if err != nil {
+			s.logger.Errorf("[Cron]lock job \"%s\" error: %s", job.name, err.Error())
+			s.record(job, CronRun{ScheduledAt: scheduledAt, Err: err, Skipped: "lock error"})
+			return
+		} else if !ok {
+			s.record(job, CronRun{ScheduledAt: scheduledAt, Skipped: "locked by other replica"})
+			return
+		}
+	}
+
+	run := CronRun{ScheduledAt: scheduledAt, StartedAt: time.Now()}
+	run.Err = s.call(ctx, job)
+	run.Duration = time.Since(run.StartedAt)
+	if run.Err != nil {
+		s.logger.Errorf("[Cron]job \"%s\" error: %s", job.name, run.Err.Error())
+	}
+	s.record(job, run)
+}
+
+func (s *CronScheduler) call(ctx context.Context, job *cronJob) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("panic: %v", r)
+		}
+	}()
+	return job.fn(ctx)
+}
+
+func (s *CronScheduler) record(job *cronJob, run CronRun) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if run.Skipped == "" {
+		job.lastRunAt = run.StartedAt
+		job.lastError = run.Err
+	}
+	if s.historySize <= 0 {
+		return
+	}
+	job.history = append(job.history, run)
+	if len(job.history) > s.historySize {
+		job.history = job.history[len(job.history)-s.historySize:]
+	}
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+var (
+	// DefaultPageSize 请求中没有 page_size 时的默认值
+	DefaultPageSize = 20
+	// MaxPageSize page_size 的最大值，超过之后使用最大值
+	MaxPageSize = 100
+)
+
+// PageParams 列表接口的分页参数，从query中读取
+//
+//	?page=2&page_size=20   按页码分页，配合 orm.QuickOrm.Paginate
+//	?cursor=xxx&page_size=20  按游标分页，配合 orm.QuickOrm.KeysetPaginate，page_size 即 limit
+type PageParams struct {
+	Page     int
+	PageSize int
+	Cursor   string
+}
+
+// ReadPageParams 读取分页参数，参数不是正整数时返回400的 ResponseException
+func ReadPageParams(ctx *gin.Context) (PageParams, error) {
+	params := PageParams{Page: 1, PageSize: DefaultPageSize, Cursor: ctx.Query("cursor")}
+
+	if s := ctx.Query("page"); s != "" {
+		page, err := strconv.Atoi(s)
+		if err != nil || page < 1 {
+			return params, NewResponseException(-1, http.StatusBadRequest, "page must be a positive integer")
+		}
+		params.Page = page
+	}
+	if s := ctx.Query("page_size"); s != "" {
+		pageSize, err := strconv.Atoi(s)
+		if err != nil || pageSize < 1 {
+			return params, NewResponseException(-1, http.StatusBadRequest, "page_size must be a positive integer")
+		}
+		params.PageSize = pageSize
+	}
+	if params.PageSize > MaxPageSize {
+		params.PageSize = MaxPageSize
+	}
+	return params, nil
+}
+
+type PageControllerMethod[T any] func(ctx *gin.Context, params PageParams) (T, error)
+
+// HandlePage 与 Handle 相同，只是先读取分页参数传给controllerMethod，返回值（比如 *orm.Pagination）包装在 utils.Result 中
+//
+//	r.GET("/users", controllers.HandlePage(c, func(ctx *gin.Context, params controllers.PageParams) (*orm.Pagination, error) {
+//		return users.Paginate(nil, params.Page, params.PageSize, "id desc")
+//	}))
+func HandlePage[T any](controller IController, controllerMethod PageControllerMethod[T]) gin.HandlerFunc {
+	return Handle(controller, func(ctx *gin.Context) (T, error) {
+		params, err := ReadPageParams(ctx)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		return controllerMethod(ctx, params)
+	})
+}